@@ -3,15 +3,19 @@ package bbhash
 
 import (
 	"fmt"
+	"iter"
+	"math/bits"
 
 	"github.com/relab/bbhash/internal/fast"
 )
 
 // BBHash represents a minimal perfect hash for a set of keys.
 type BBHash struct {
-	bits       []bitVector // bit vectors for each level
-	ranks      []uint64    // total rank for each level
-	reverseMap []uint64    // index -> key (only filled if needed)
+	bits       []bitVector    // bit vectors for each level
+	ranks      []uint64       // total rank for each level
+	reverseMap []uint64       // index -> key (only filled if needed)
+	compressed *compressedMap // compressed reverse map (replaces reverseMap if requested)
+	cpp        *cppState      // state of the C++ compatible hashing (nil unless requested)
 }
 
 func newBBHash(initialLevels int) BBHash {
@@ -32,6 +36,9 @@ func newBBHash(initialLevels int) BBHash {
 // 1. The return value is 0, representing that the key was not in the original key set.
 // 2. The return value is in the expected range [1, len(keys)], but is a false positive.
 func (bb BBHash) Find(key uint64) uint64 {
+	if bb.cpp != nil {
+		return bb.findCPP(key)
+	}
 	for lvl, bv := range bb.bits {
 		i := fast.Hash(uint64(lvl), key) % bv.size()
 		if bv.isSet(i) {
@@ -41,72 +48,125 @@ func (bb BBHash) Find(key uint64) uint64 {
 	return 0
 }
 
-// Key returns the key for the given index.
-// The index must be in the range [1, len(keys)], otherwise 0 is returned.
-func (bb BBHash) Key(index uint64) uint64 {
-	if bb.reverseMap == nil || index == 0 || int(index) >= len(bb.reverseMap) {
-		return 0
+// Lookup returns the index of the key in the range [1, len(keys)] and true,
+// or 0 and false if the key is not found. As with Find, a key that is not in
+// the original key set may be reported as found (a false positive).
+func (bb BBHash) Lookup(key uint64) (uint64, bool) {
+	index := bb.Find(key)
+	return index, index != 0
+}
+
+// Index is like Lookup, but returns a 0-based index in the range [0, len(keys)),
+// suitable for indexing a slice of values, or 0 and false if the key is not found.
+func (bb BBHash) Index(key uint64) (uint64, bool) {
+	index := bb.Find(key)
+	if index == 0 {
+		return 0, false
 	}
-	return bb.reverseMap[index]
+	return index - 1, true
 }
 
-// compute computes the minimal perfect hash for the given keys.
-func (bb *BBHash) compute(keys []uint64, gamma float64) error {
-	sz := len(keys)
-	redo := make([]uint64, 0, sz/2) // heuristic: only 1/2 of the keys will collide
-	// bit vectors for current level : A and C in the paper
-	lvlVector := newBCVector(words(sz, gamma))
+// FindExact returns the index of the key in the range [1, len(keys)] and true,
+// or 0 and false if the key is not in the original key set. Unlike Lookup,
+// FindExact has no false positives, since it compares the key with the key
+// stored in the reverse map. FindExact panics if the BBHash has no reverse map.
+func (bb BBHash) FindExact(key uint64) (uint64, bool) {
+	if !bb.HasReverseMap() {
+		panic("bbhash: FindExact requires a reverse map (see WithReverseMap)")
+	}
+	index := bb.Find(key)
+	if k, ok := bb.LookupKey(index); !ok || k != key {
+		return 0, false
+	}
+	return index, true
+}
 
-	// loop exits when there are no more keys to re-hash (see break statement below)
-	for lvl := 0; true; lvl++ {
-		// precompute the level hash to speed up the key hashing
-		lvlHash := fast.LevelHash(uint64(lvl))
+// Contains returns true if the key is in the original key set.
+// Contains panics if the BBHash has no reverse map.
+func (bb BBHash) Contains(key uint64) bool {
+	_, ok := bb.FindExact(key)
+	return ok
+}
 
-		// find colliding keys and possible bit vector positions for non-colliding keys
-		for _, k := range keys {
-			h := fast.KeyHash(lvlHash, k)
-			// update the bit and collision vectors for the current level
-			lvlVector.update(h)
-		}
+// HasReverseMap returns true if the BBHash has a reverse map.
+func (bb BBHash) HasReverseMap() bool {
+	return len(bb.reverseMap) > 0 || bb.compressed != nil
+}
 
-		// remove bit vector position assignments for colliding keys and add them to the redo set
-		for _, k := range keys {
-			h := fast.KeyHash(lvlHash, k)
-			// unset the bit vector position for the current key if it collided
-			if lvlVector.unsetCollision(h) {
-				// keys to re-hash at next level : F in the paper
-				redo = append(redo, k)
-			}
+// Key returns the key for the given index.
+// The index must be in the range [1, len(keys)], otherwise 0 is returned.
+// Since 0 is also a valid key, use LookupKey to distinguish invalid indices.
+func (bb BBHash) Key(index uint64) uint64 {
+	key, _ := bb.LookupKey(index)
+	return key
+}
+
+// LookupKey returns the key for the given index and true, or 0 and false if the
+// index is not in the range [1, len(keys)] or the BBHash has no reverse map.
+func (bb BBHash) LookupKey(index uint64) (uint64, bool) {
+	if bb.compressed != nil {
+		if index == 0 || index > bb.compressed.len() {
+			return 0, false
 		}
+		return bb.compressed.key(index), true
+	}
+	if index == 0 || index >= uint64(len(bb.reverseMap)) {
+		return 0, false
+	}
+	return bb.reverseMap[index], true
+}
 
-		// save the current bit vector for the current level
-		bb.bits = append(bb.bits, lvlVector.bitVector())
+// Len returns the number of keys in the BBHash.
+func (bb BBHash) Len() int {
+	return int(bb.entries())
+}
 
-		sz = len(redo)
-		if sz == 0 {
-			break
+// All returns an iterator over the (index, key) pairs of the BBHash in index order,
+// with indices in the range [1, Len()]. All panics if the BBHash has no reverse map.
+func (bb BBHash) All() iter.Seq2[uint64, uint64] {
+	if !bb.HasReverseMap() {
+		panic("bbhash: All requires a reverse map (see WithReverseMap)")
+	}
+	return func(yield func(uint64, uint64) bool) {
+		bb.all(0, yield)
+	}
+}
+
+// all yields the (index, key) pairs of the BBHash, with offset added to the indices.
+// It returns false if yield returned false.
+func (bb BBHash) all(offset uint64, yield func(uint64, uint64) bool) bool {
+	for index := range bb.entries() {
+		key, _ := bb.LookupKey(index + 1)
+		if !yield(offset+index+1, key) {
+			return false
 		}
-		// move to next level and compute the set of keys to re-hash (that had collisions)
-		keys = redo
-		redo = redo[:0]
-		lvlVector.nextLevel(words(sz, gamma))
+	}
+	return true
+}
 
-		if lvl > maxLevel {
-			return fmt.Errorf("can't find minimal perfect hash after %d tries", lvl)
+// Keys returns an iterator over the keys of the BBHash in index order.
+// Keys panics if the BBHash has no reverse map.
+func (bb BBHash) Keys() iter.Seq[uint64] {
+	return keys(bb.All())
+}
+
+// keys returns an iterator over the keys of the (index, key) pairs.
+func keys(all iter.Seq2[uint64, uint64]) iter.Seq[uint64] {
+	return func(yield func(uint64) bool) {
+		for _, key := range all {
+			if !yield(key) {
+				return
+			}
 		}
 	}
-	bb.computeLevelRanks()
-	return nil
 }
 
-// computeWithKeymap is similar to compute(), but in addition returns the reverse keymap.
-func (bb *BBHash) computeWithKeymap(keys []uint64, gamma float64) error {
+// compute computes the minimal perfect hash for the given keys.
+func (bb *BBHash) compute(keys []uint64, gamma float64) error {
 	sz := len(keys)
 	redo := make([]uint64, 0, sz/2) // heuristic: only 1/2 of the keys will collide
 	// bit vectors for current level : A and C in the paper
 	lvlVector := newBCVector(words(sz, gamma))
-	bb.reverseMap = make([]uint64, len(keys)+1)
-	levelKeysMap := make([][]uint64, 0, len(bb.bits)) // number of initial levels = len(bb.bits)
 
 	// loop exits when there are no more keys to re-hash (see break statement below)
 	for lvl := 0; true; lvl++ {
@@ -121,20 +181,14 @@ func (bb *BBHash) computeWithKeymap(keys []uint64, gamma float64) error {
 		}
 
 		// remove bit vector position assignments for colliding keys and add them to the redo set
-		levelKeys := make([]uint64, lvlVector.size())
 		for _, k := range keys {
 			h := fast.KeyHash(lvlHash, k)
 			// unset the bit vector position for the current key if it collided
 			if lvlVector.unsetCollision(h) {
 				// keys to re-hash at next level : F in the paper
 				redo = append(redo, k)
-			} else {
-				// keys for the current level used to construct the reverse map.
-				// keys are ordered by their bit vector position to avoid sorting later.
-				levelKeys[h%lvlVector.size()] = k
 			}
 		}
-		levelKeysMap = append(levelKeysMap, levelKeys)
 
 		// save the current bit vector for the current level
 		bb.bits = append(bb.bits, lvlVector.bitVector())
@@ -153,14 +207,33 @@ func (bb *BBHash) computeWithKeymap(keys []uint64, gamma float64) error {
 		}
 	}
 	bb.computeLevelRanks()
+	return nil
+}
 
-	// Compute the reverse map
-	index := 1
-	for _, levelKeys := range levelKeysMap {
-		for _, key := range levelKeys {
-			if key != 0 {
-				bb.reverseMap[index] = key
-				index++
+// computeWithKeymap is similar to compute(), but in addition computes the reverse map.
+// The reverse map is filled in a second pass over the keys, once the bit vectors are
+// final, using a table with the rank of each word of the bit vectors. Hence, the extra
+// memory used is proportional to the size of the bit vectors (gamma/8 bytes per key),
+// instead of storing the keys of each level by their bit vector position.
+func (bb *BBHash) computeWithKeymap(keys []uint64, gamma float64) error {
+	if err := bb.compute(keys, gamma); err != nil {
+		return err
+	}
+	levelHashes := make([]uint64, len(bb.bits))
+	wordRanks := make([][]uint64, len(bb.bits))
+	for lvl, bv := range bb.bits {
+		levelHashes[lvl] = fast.LevelHash(uint64(lvl))
+		wordRanks[lvl] = bv.wordRanks(bb.ranks[lvl])
+	}
+
+	bb.reverseMap = make([]uint64, len(keys)+1)
+	for _, k := range keys {
+		for lvl, bv := range bb.bits {
+			i := fast.KeyHash(levelHashes[lvl], k) % bv.size()
+			if bv.isSet(i) {
+				x, y := i/64, i%64
+				bb.reverseMap[wordRanks[lvl][x]+uint64(bits.OnesCount64(bv[x]<<(64-y)))] = k
+				break
 			}
 		}
 	}
@@ -0,0 +1,145 @@
+package bbhash
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"slices"
+)
+
+// compressedMap is a compressed reverse map. It holds the keys in sorted order,
+// encoded with Elias-Fano, and a permutation that maps each index to the position
+// of its key in the sorted order, packed with the minimal bit width. For n keys
+// with the largest key u, it uses about 2 + log2(u/n) + log2(n) bits per key, which
+// is much less than 64 bits per key when the keys are clustered, such as sequential
+// or dense IDs. For random 64-bit keys, it uses slightly more than 64 bits per key.
+type compressedMap struct {
+	keys eliasFano
+	perm packedInts // perm.get(index-1) is the position in keys of the key with the given index
+}
+
+// newCompressedMap returns a compressed reverse map for the keys in index order,
+// that is, keys[index-1] is the key with the given index.
+func newCompressedMap(keys []uint64) *compressedMap {
+	sorted := slices.Sorted(slices.Values(keys))
+	n := uint64(len(keys))
+	m := &compressedMap{
+		keys: newEliasFano(sorted),
+		perm: newPackedInts(n, permWidth(n)),
+	}
+	for i, key := range keys {
+		j, _ := slices.BinarySearch(sorted, key)
+		m.perm.set(uint64(i), uint64(j))
+	}
+	return m
+}
+
+// permWidth returns the number of bits needed for the positions of n keys.
+func permWidth(n uint64) uint {
+	if n <= 1 {
+		return 0
+	}
+	return uint(bits.Len64(n - 1))
+}
+
+// len returns the number of keys in the map.
+func (m *compressedMap) len() uint64 {
+	return m.keys.n
+}
+
+// key returns the key with the given index, which must be in the range [1, len()].
+func (m *compressedMap) key(index uint64) uint64 {
+	return m.keys.get(m.perm.get(index - 1))
+}
+
+// sizeBits returns the number of bits used by the map.
+func (m *compressedMap) sizeBits() uint64 {
+	return m.keys.sizeBits() + 64*uint64(len(m.perm.data))
+}
+
+// marshaledLength returns the number of bytes needed to marshal the map.
+func (m *compressedMap) marshaledLength() int {
+	return m.keys.marshaledLength() + uint64bytes*len(m.perm.data)
+}
+
+// appendBinary appends the map to buf: the Elias-Fano encoding of the sorted keys,
+// followed by the packed permutation. The number of keys is not included, since
+// it is given by the bit vectors of the BBHash.
+func (m *compressedMap) appendBinary(buf []byte) []byte {
+	buf = m.keys.appendBinary(buf)
+	for _, w := range m.perm.data {
+		buf = binary.LittleEndian.AppendUint64(buf, w)
+	}
+	return buf
+}
+
+// unmarshalCompressedMap decodes a map of n keys written by appendBinary,
+// which must use all of buf.
+func unmarshalCompressedMap(buf []byte, n uint64) (*compressedMap, error) {
+	keys, buf, err := unmarshalEliasFano(buf, n)
+	if err != nil {
+		return nil, err
+	}
+	m := &compressedMap{keys: keys, perm: newPackedInts(n, permWidth(n))}
+	if uint64(len(buf)) != uint64bytes*uint64(len(m.perm.data)) {
+		return nil, errors.New("compressed reverse map length does not match number of keys")
+	}
+	for i := range m.perm.data {
+		m.perm.data[i] = binary.LittleEndian.Uint64(buf)
+		buf = buf[uint64bytes:]
+	}
+	for i := range n {
+		if m.perm.get(i) >= n {
+			return nil, errors.New("invalid compressed reverse map permutation")
+		}
+	}
+	return m, nil
+}
+
+// compressReverseMap replaces the reverse map with a compressed reverse map.
+func (bb *BBHash) compressReverseMap() {
+	bb.compressed = newCompressedMap(bb.reverseMap[1:])
+	bb.reverseMap = nil
+}
+
+// ReverseMapBitsPerKey returns the number of bits per key used by the reverse map,
+// or 0 if the BBHash has no reverse map.
+func (bb BBHash) ReverseMapBitsPerKey() float64 {
+	entries := bb.entries()
+	if entries == 0 || !bb.HasReverseMap() {
+		return 0
+	}
+	return float64(bb.reverseMapBits()) / float64(entries)
+}
+
+// reverseMapBits returns the number of bits used by the reverse map.
+func (bb BBHash) reverseMapBits() uint64 {
+	if bb.compressed != nil {
+		return bb.compressed.sizeBits()
+	}
+	return 64 * uint64(max(len(bb.reverseMap)-1, 0))
+}
+
+// ReverseMapBitsPerKey returns the number of bits per key used by the reverse map,
+// or 0 if the BBHash2 has no reverse map.
+func (bb BBHash2) ReverseMapBitsPerKey() float64 {
+	entries := bb.entries()
+	if entries == 0 || !bb.HasReverseMap() {
+		return 0
+	}
+	var sz uint64
+	for _, b := range bb.partitions {
+		sz += b.reverseMapBits()
+	}
+	return float64(sz) / float64(entries)
+}
+
+// compressedReverseMap returns true if all partitions have a compressed reverse map.
+func (bb BBHash2) compressedReverseMap() bool {
+	for _, b := range bb.partitions {
+		if b.compressed == nil {
+			return false
+		}
+	}
+	return len(bb.partitions) > 0
+}
@@ -0,0 +1,245 @@
+package bbhash
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	// containerMagic identifies a container file.
+	containerMagic = "BBHC"
+
+	// containerVersion is the version of the container format.
+	containerVersion = 1
+
+	// containerHeaderLength is the length of the container header: magic, version and number of entries.
+	containerHeaderLength = len(containerMagic) + 1 + uint32bytes
+
+	// tocEntryLength is the length of a table of contents entry, excluding the name:
+	// name length, entry offset and entry length.
+	tocEntryLength = 2 + uint64bytes + uint64bytes
+)
+
+// Container holds a set of named BBHash2 functions to be written to a single file.
+// The file starts with a table of contents holding the name, offset and length of
+// each entry, followed by the entries in the indexed encoding (see AppendIndexed).
+// This allows an entry to be read without decoding the others; see OpenContainer.
+//
+// The zero value is an empty container ready to use.
+type Container struct {
+	names   []string
+	entries map[string]*BBHash2
+}
+
+// Add adds the BBHash2 under the given name to the container.
+// Names must be unique, non-empty and at most 65535 bytes long.
+func (c *Container) Add(name string, bb *BBHash2) error {
+	if name == "" || len(name) > math.MaxUint16 {
+		return fmt.Errorf("Container.Add: invalid name length %d (max %d)", len(name), math.MaxUint16)
+	}
+	if bb == nil || len(bb.partitions) == 0 {
+		return fmt.Errorf("Container.Add: no data for %q", name)
+	}
+	if _, ok := c.entries[name]; ok {
+		return fmt.Errorf("Container.Add: duplicate name %q", name)
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]*BBHash2)
+	}
+	c.names = append(c.names, name)
+	c.entries[name] = bb
+	return nil
+}
+
+// Names returns the names of the container's entries in the order they were added.
+func (c *Container) Names() []string {
+	return append([]string(nil), c.names...)
+}
+
+// tocLength returns the length of the header and table of contents.
+func (c *Container) tocLength() int {
+	tocLen := containerHeaderLength
+	for _, name := range c.names {
+		tocLen += tocEntryLength + len(name)
+	}
+	return tocLen
+}
+
+// WriteTo implements the [io.WriterTo] interface.
+// Entries are encoded one at a time, so only one encoded entry is held in memory.
+func (c *Container) WriteTo(w io.Writer) (int64, error) {
+	// append header: magic, version and the number of entries
+	buf := make([]byte, 0, c.tocLength())
+	buf = append(buf, containerMagic...)
+	buf = append(buf, containerVersion)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(c.names)))
+
+	// append the table of contents: name, offset and length of each entry
+	offset := uint64(c.tocLength())
+	for _, name := range c.names {
+		entryLen := uint64(c.entries[name].indexedLength())
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(name)))
+		buf = append(buf, name...)
+		buf = binary.LittleEndian.AppendUint64(buf, offset)
+		buf = binary.LittleEndian.AppendUint64(buf, entryLen)
+		offset += entryLen
+	}
+
+	n, err := w.Write(buf)
+	written := int64(n)
+	if err != nil {
+		return written, err
+	}
+	for _, name := range c.names {
+		data, err := c.entries[name].MarshalIndexed()
+		if err != nil {
+			return written, fmt.Errorf("Container.WriteTo: %q: %w", name, err)
+		}
+		n, err := w.Write(data)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// containerEntry is the location of an entry in a container file.
+type containerEntry struct {
+	offset uint64
+	length uint64
+}
+
+// ContainerFile provides random access to the entries of a container written by Container.WriteTo.
+// It is safe for concurrent use if the underlying reader is.
+type ContainerFile struct {
+	r       io.ReaderAt
+	closer  io.Closer
+	names   []string
+	entries map[string]containerEntry
+}
+
+// OpenContainer opens the container file at path and reads its table of contents.
+// The caller must call Close when done with the file.
+func OpenContainer(path string) (*ContainerFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	cf, err := ReadContainer(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	cf.closer = f
+	return cf, nil
+}
+
+// ReadContainer reads the table of contents of the container held by r.
+// It returns an error if an entry extends beyond the end of the data in r.
+func ReadContainer(r io.ReaderAt) (*ContainerFile, error) {
+	header := make([]byte, containerHeaderLength)
+	if err := readAt(r, header, 0); err != nil {
+		return nil, fmt.Errorf("bbhash.ReadContainer: reading header: %w", err)
+	}
+	if string(header[:len(containerMagic)]) != containerMagic {
+		return nil, errors.New("bbhash.ReadContainer: not a container")
+	}
+	header = header[len(containerMagic):] // move past magic
+	if version := header[0]; version != containerVersion {
+		return nil, fmt.Errorf("bbhash.ReadContainer: unsupported version %d (want %d)", version, containerVersion)
+	}
+	numEntries := binary.LittleEndian.Uint32(header[1:])
+
+	cf := &ContainerFile{
+		r:       r,
+		entries: make(map[string]containerEntry),
+	}
+	size := readerSize(r)
+	off := int64(containerHeaderLength)
+	nameLenBuf := make([]byte, 2)
+	for range numEntries {
+		// Read the name length, followed by the name, offset and length
+		if err := readAt(r, nameLenBuf, off); err != nil {
+			return nil, fmt.Errorf("bbhash.ReadContainer: reading table of contents: %w", err)
+		}
+		nameLen := int(binary.LittleEndian.Uint16(nameLenBuf))
+		buf := make([]byte, nameLen+2*uint64bytes)
+		if err := readAt(r, buf, off+2); err != nil {
+			return nil, fmt.Errorf("bbhash.ReadContainer: reading table of contents: %w", err)
+		}
+		off += int64(2 + len(buf))
+
+		name := string(buf[:nameLen])
+		if _, ok := cf.entries[name]; ok {
+			return nil, fmt.Errorf("bbhash.ReadContainer: duplicate name %q", name)
+		}
+		e := containerEntry{
+			offset: binary.LittleEndian.Uint64(buf[nameLen:]),
+			length: binary.LittleEndian.Uint64(buf[nameLen+uint64bytes:]),
+		}
+		if e.offset > math.MaxInt64 || e.length > math.MaxInt64 {
+			return nil, fmt.Errorf("bbhash.ReadContainer: invalid location of entry %q", name)
+		}
+		if err := checkExtent(r, size, int64(e.offset), int64(e.length)); err != nil {
+			return nil, fmt.Errorf("bbhash.ReadContainer: entry %q: %w", name, err)
+		}
+		cf.names = append(cf.names, name)
+		cf.entries[name] = e
+	}
+	return cf, nil
+}
+
+// Names returns the names of the container's entries in the order they were written.
+func (cf *ContainerFile) Names() []string {
+	return append([]string(nil), cf.names...)
+}
+
+// section returns a reader for the entry with the given name.
+// The location of the entry was checked by ReadContainer.
+func (cf *ContainerFile) section(name string) (*io.SectionReader, error) {
+	e, ok := cf.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("bbhash: no entry named %q in container", name)
+	}
+	return io.NewSectionReader(cf.r, int64(e.offset), int64(e.length)), nil
+}
+
+// Get reads and decodes the entry with the given name.
+func (cf *ContainerFile) Get(name string) (*BBHash2, error) {
+	sr, err := cf.section(name)
+	if err != nil {
+		return nil, fmt.Errorf("ContainerFile.Get: %w", err)
+	}
+	data := make([]byte, sr.Size())
+	if err := readAt(sr, data, 0); err != nil {
+		return nil, fmt.Errorf("ContainerFile.Get: reading %q: %w", name, err)
+	}
+	bb := &BBHash2{}
+	if err := bb.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("ContainerFile.Get: %q: %w", name, err)
+	}
+	return bb, nil
+}
+
+// Lazy returns a LazyBBHash2 for the entry with the given name,
+// which decodes the entry's partitions on demand; see OpenLazy.
+func (cf *ContainerFile) Lazy(name string, opts ...LazyOptions) (*LazyBBHash2, error) {
+	sr, err := cf.section(name)
+	if err != nil {
+		return nil, fmt.Errorf("ContainerFile.Lazy: %w", err)
+	}
+	return OpenLazy(sr, opts...)
+}
+
+// Close closes the underlying file if the container was opened with OpenContainer.
+func (cf *ContainerFile) Close() error {
+	if cf.closer == nil {
+		return nil
+	}
+	return cf.closer.Close()
+}
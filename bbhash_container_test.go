@@ -0,0 +1,143 @@
+package bbhash_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/relab/bbhash"
+)
+
+func TestContainer(t *testing.T) {
+	tables := []struct {
+		name       string
+		size       int
+		partitions int
+	}{
+		{name: "users", size: 100, partitions: 1},
+		{name: "orders", size: 10000, partitions: 4},
+		{name: "items", size: 100000, partitions: 16},
+	}
+
+	c := &bbhash.Container{}
+	keys := make(map[string][]uint64)
+	funcs := make(map[string]*bbhash.BBHash2)
+	for i, tbl := range tables {
+		keys[tbl.name] = generateKeys(tbl.size, i)
+		bb, err := bbhash.New(keys[tbl.name], bbhash.Partitions(tbl.partitions))
+		if err != nil {
+			t.Fatalf("Failed to create BBHash2: %v", err)
+		}
+		funcs[tbl.name] = bb
+		if err := c.Add(tbl.name, bb); err != nil {
+			t.Fatalf("Add(%q) failed: %v", tbl.name, err)
+		}
+	}
+	if err := c.Add("users", funcs["users"]); err == nil {
+		t.Error("Add() should have failed for a duplicate name")
+	}
+	if err := c.Add("", funcs["users"]); err == nil {
+		t.Error("Add() should have failed for an empty name")
+	}
+
+	path := filepath.Join(t.TempDir(), "tables.bbhc")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.WriteTo(f); err != nil {
+		t.Fatalf("WriteTo() failed: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cf, err := bbhash.OpenContainer(path)
+	if err != nil {
+		t.Fatalf("OpenContainer() failed: %v", err)
+	}
+	defer cf.Close()
+
+	if got, want := cf.Names(), c.Names(); !slices.Equal(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+	for _, tbl := range tables {
+		bb, err := cf.Get(tbl.name)
+		if err != nil {
+			t.Fatalf("Get(%q) failed: %v", tbl.name, err)
+		}
+		lb, err := cf.Lazy(tbl.name)
+		if err != nil {
+			t.Fatalf("Lazy(%q) failed: %v", tbl.name, err)
+		}
+		for _, key := range keys[tbl.name] {
+			want := funcs[tbl.name].Find(key)
+			if got := bb.Find(key); got != want {
+				t.Fatalf("Get(%q).Find(%d) = %d, want %d", tbl.name, key, got, want)
+			}
+			if got := lb.Find(key); got != want {
+				t.Fatalf("Lazy(%q).Find(%d) = %d, want %d", tbl.name, key, got, want)
+			}
+		}
+	}
+	if _, err := cf.Get("missing"); err == nil {
+		t.Error("Get() should have failed for a missing name")
+	}
+}
+
+func TestReadContainerErrors(t *testing.T) {
+	c := &bbhash.Container{}
+	bb, err := bbhash.New(generateKeys(1000, 1))
+	if err != nil {
+		t.Fatalf("Failed to create BBHash2: %v", err)
+	}
+	if err := c.Add("only", bb); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	if _, err := bbhash.ReadContainer(bytes.NewReader(data[:12])); err == nil {
+		t.Error("ReadContainer() should have failed for a truncated table of contents")
+	}
+	bad := bytes.Clone(data)
+	bad[0] = 'X'
+	if _, err := bbhash.ReadContainer(bytes.NewReader(bad)); err == nil {
+		t.Error("ReadContainer() should have failed for an invalid magic")
+	}
+
+	// A truncated entry is detected from the size of the reader, or by reading its last byte
+	for _, r := range []io.ReaderAt{bytes.NewReader(data[:len(data)-1]), readerAt{bytes.NewReader(data[:len(data)-1])}} {
+		if _, err := bbhash.ReadContainer(r); err == nil {
+			t.Errorf("ReadContainer() should have failed for a truncated entry (%T)", r)
+		}
+	}
+
+	// A corrupt entry length is reported instead of allocating a buffer for it
+	entryData, _ := bb.MarshalIndexed()
+	lengthOffset := len(data) - len(entryData) - 8 // the length is the last field of the table of contents
+	corrupt := bytes.Clone(data)
+	binary.LittleEndian.PutUint64(corrupt[lengthOffset:], math.MaxInt64)
+	for _, r := range []io.ReaderAt{bytes.NewReader(corrupt), readerAt{bytes.NewReader(corrupt)}} {
+		if _, err := bbhash.ReadContainer(r); err == nil {
+			t.Errorf("ReadContainer() should have failed for a corrupt entry length (%T)", r)
+		}
+	}
+
+	// Intact data is accepted from a reader without a Size method
+	cf, err := bbhash.ReadContainer(readerAt{bytes.NewReader(data)})
+	if err != nil {
+		t.Fatalf("ReadContainer() failed: %v", err)
+	}
+	if _, err := cf.Get("only"); err != nil {
+		t.Errorf("Get() failed: %v", err)
+	}
+}
@@ -0,0 +1,404 @@
+package bbhash
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// The reference C++ implementation of BBHash (BooPHF.h, https://github.com/rizkg/BBHash)
+// hashes a uint64 key at level 0 and 1 with its hash64 function using two fixed seeds,
+// and at the following levels with a xorshift128+ generator seeded by those two hashes.
+// The hash is reduced to a position in the level's bit vector with a multiply-shift
+// (fastrange64), and the level sizes follow from the number of keys and gamma.
+// After cppLevels-1 levels, the remaining keys are stored in a map.
+const (
+	// cppLevels is the number of levels of the reference C++ implementation,
+	// including the last level, whose keys are stored in a map.
+	cppLevels = 25
+
+	// cppSeed0 and cppSeed1 are the seeds of the hashes at level 0 and 1.
+	cppSeed0 = 0xAAAAAAAA55555555
+	cppSeed1 = 0x33333333CCCCCCCC
+
+	// cppRankSample is the number of bits per rank sample of the C++ bit vectors.
+	cppRankSample = 512
+
+	// cppHeaderLength is the length of the C++ header: gamma (double), number of
+	// levels (int), rank of the last level (uint64) and number of keys (uint64).
+	cppHeaderLength = uint64bytes + uint32bytes + uint64bytes + uint64bytes
+)
+
+// cppState holds the state of a BBHash that uses the hash functions of the
+// reference C++ implementation; see CompatibleHash.
+type cppState struct {
+	gamma float64
+	final map[uint64]uint64 // key -> 0-based index among the keys of the last level
+}
+
+// cppHash64 returns the hash64 function of the reference C++ implementation.
+func cppHash64(key, seed uint64) uint64 {
+	h := seed
+	h ^= (h << 7) ^ key*(h>>3) ^ ^((h << 11) + (key ^ (h >> 5)))
+	h = ^h + (h << 21)
+	h ^= h >> 24
+	h = (h + (h << 3)) + (h << 8)
+	h ^= h >> 14
+	h = (h + (h << 2)) + (h << 4)
+	h ^= h >> 28
+	h += h << 31
+	return h
+}
+
+// cppLevelHash returns the hash of the key at the given level. It must be called
+// for levels 0, 1, 2, ... in order, with s holding the state between calls.
+func cppLevelHash(s *[2]uint64, lvl int, key uint64) uint64 {
+	switch lvl {
+	case 0:
+		s[0] = cppHash64(key, cppSeed0)
+		return s[0]
+	case 1:
+		s[1] = cppHash64(key, cppSeed1)
+		return s[1]
+	}
+	s1, s0 := s[0], s[1]
+	s[0] = s0
+	s1 ^= s1 << 23
+	s[1] = s1 ^ s0 ^ (s1 >> 17) ^ (s0 >> 26)
+	return s[1] + s0
+}
+
+// cppHashAt returns the hash of the key at the given level.
+func cppHashAt(key uint64, lvl int) uint64 {
+	var s [2]uint64
+	var h uint64
+	for l := 0; l <= lvl; l++ {
+		h = cppLevelHash(&s, l, key)
+	}
+	return h
+}
+
+// fastRange maps the hash h to the range [0, n) as fastrange64 does.
+func fastRange(h, n uint64) uint64 {
+	hi, _ := bits.Mul64(h, n)
+	return hi
+}
+
+// cppLevelSizes returns the number of bits of each level of the reference C++
+// implementation for n keys; each size is a multiple of 64. The C++ load method
+// recomputes the sizes with the same formula, while UnmarshalCPP uses the sizes
+// stored in the encoding.
+func cppLevelSizes(n uint64, gamma float64) []uint64 {
+	domain := uint64(math.Ceil(float64(n) * gamma))
+	collision := 1 - math.Pow((gamma*float64(n)-1)/(gamma*float64(n)), float64(n-1))
+	sizes := make([]uint64, cppLevels)
+	for i := range sizes {
+		size := (uint64(float64(domain)*math.Pow(collision, float64(i))) + 63) / 64 * 64
+		sizes[i] = max(size, 64)
+	}
+	return sizes
+}
+
+// computeCPP computes the minimal perfect hash for the given keys with the hash
+// functions, level sizes and last-level map of the reference C++ implementation.
+func (bb *BBHash) computeCPP(keys []uint64, gamma float64) {
+	sizes := cppLevelSizes(uint64(len(keys)), gamma)
+	redo := make([]uint64, 0, len(keys)/2)
+	lvlVector := newBCVector(sizes[0] / 64)
+	for lvl := range cppLevels - 1 {
+		size := lvlVector.size()
+		for _, k := range keys {
+			lvlVector.update(fastRange(cppHashAt(k, lvl), size))
+		}
+		for _, k := range keys {
+			if lvlVector.unsetCollision(fastRange(cppHashAt(k, lvl), size)) {
+				redo = append(redo, k)
+			}
+		}
+		bb.bits = append(bb.bits, lvlVector.bitVector())
+		keys = redo
+		redo = redo[:0]
+		lvlVector.nextLevel(sizes[lvl+1] / 64)
+	}
+	// the last level has no bits; its keys are stored in a map
+	bb.bits = append(bb.bits, lvlVector.bitVector())
+	bb.cpp = &cppState{gamma: gamma, final: make(map[uint64]uint64, len(keys))}
+	for i, k := range keys {
+		bb.cpp.final[k] = uint64(i)
+	}
+	bb.computeLevelRanks()
+}
+
+// computeCPPWithKeymap is similar to computeCPP(), but in addition computes the reverse map.
+func (bb *BBHash) computeCPPWithKeymap(keys []uint64, gamma float64) {
+	bb.computeCPP(keys, gamma)
+	bb.reverseMap = make([]uint64, len(keys)+1)
+	for _, k := range keys {
+		bb.reverseMap[bb.findCPP(k)] = k
+	}
+}
+
+// findCPP is Find for a BBHash created with CompatibleHash.
+func (bb BBHash) findCPP(key uint64) uint64 {
+	last := len(bb.bits) - 1
+	var s [2]uint64
+	for lvl, bv := range bb.bits[:last] {
+		i := fastRange(cppLevelHash(&s, lvl, key), bv.size())
+		if bv.isSet(i) {
+			return bb.ranks[lvl] + bv.rank(i)
+		}
+	}
+	if index, ok := bb.cpp.final[key]; ok {
+		return bb.ranks[last] + index
+	}
+	return 0
+}
+
+// CompatibleHash reports whether bb uses the hash functions of the reference C++
+// implementation, and can thus be encoded with MarshalCPP.
+func (bb BBHash) CompatibleHash() bool {
+	return bb.cpp != nil
+}
+
+// cppLength returns the number of bytes needed to encode the BBHash in the C++ format.
+func (bb BBHash) cppLength() int {
+	n := cppHeaderLength + uint64bytes // header and size of the last-level map
+	for _, bv := range bb.bits {
+		words := len(bv) + 1
+		n += 3*uint64bytes + uint64bytes*words + uint64bytes*((words+7)/8)
+	}
+	return n + 2*uint64bytes*len(bb.cpp.final)
+}
+
+// AppendCPP appends the encoding of bb in the format of the save method of the
+// reference C++ implementation (boomphf::mphf<uint64_t, SingleHashFunctor<uint64_t>>)
+// to buf. The C++ lookup method returns Find(key)-1 for the loaded function.
+// The BBHash must have been created with the CompatibleHash option, or decoded with
+// UnmarshalCPP. The reverse map is not included in the encoding.
+func (bb BBHash) AppendCPP(buf []byte) ([]byte, error) {
+	if bb.cpp == nil {
+		return nil, errors.New("BBHash.AppendCPP: not created with CompatibleHash")
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(bb.cpp.gamma))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(bb.bits)))
+	buf = binary.LittleEndian.AppendUint64(buf, bb.ranks[len(bb.bits)-1]-1)
+	buf = binary.LittleEndian.AppendUint64(buf, bb.entries())
+
+	// append each level as a C++ bit vector: the number of bits, the number of words,
+	// the words (with an extra zero word) and the rank of every 512-bit block,
+	// which includes the bits of the preceding levels
+	for lvl, bv := range bb.bits {
+		words := uint64(len(bv) + 1)
+		buf = binary.LittleEndian.AppendUint64(buf, bv.size())
+		buf = binary.LittleEndian.AppendUint64(buf, words)
+		for _, w := range bv {
+			buf = binary.LittleEndian.AppendUint64(buf, w)
+		}
+		buf = binary.LittleEndian.AppendUint64(buf, 0)
+		buf = binary.LittleEndian.AppendUint64(buf, (words+7)/8)
+		for i, rank := range bv.wordRanks(bb.ranks[lvl] - 1) {
+			if i%(cppRankSample/64) == 0 {
+				buf = binary.LittleEndian.AppendUint64(buf, rank)
+			}
+		}
+		if len(bv)%(cppRankSample/64) == 0 {
+			// the extra word starts a new block
+			buf = binary.LittleEndian.AppendUint64(buf, bb.ranks[lvl]-1+bv.onesCount())
+		}
+	}
+
+	// append the last-level map in index order
+	final := make([]uint64, len(bb.cpp.final))
+	for k, index := range bb.cpp.final {
+		final[index] = k
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(final)))
+	for index, k := range final {
+		buf = binary.LittleEndian.AppendUint64(buf, k)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(index))
+	}
+	return buf, nil
+}
+
+// MarshalCPP returns the encoding of bb in the format of the reference C++
+// implementation; see AppendCPP.
+func (bb BBHash) MarshalCPP() ([]byte, error) {
+	if bb.cpp == nil {
+		return nil, errors.New("BBHash.MarshalCPP: not created with CompatibleHash")
+	}
+	return bb.AppendCPP(make([]byte, 0, bb.cppLength()))
+}
+
+// cppDecoder reads little-endian integers from a C++ encoding.
+type cppDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *cppDecoder) uint64() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) < uint64bytes {
+		d.err = errors.New("insufficient data")
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(d.buf)
+	d.buf = d.buf[uint64bytes:]
+	return v
+}
+
+func (d *cppDecoder) uint32() uint32 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) < uint32bytes {
+		d.err = errors.New("insufficient data")
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(d.buf)
+	d.buf = d.buf[uint32bytes:]
+	return v
+}
+
+// length reads a count of items of the given size, and checks that the remaining
+// data can hold them before they are allocated.
+func (d *cppDecoder) length(size int) uint64 {
+	n := d.uint64()
+	if d.err == nil && n > uint64(len(d.buf)/size) {
+		d.err = fmt.Errorf("length %d exceeds the remaining data", n)
+		return 0
+	}
+	return n
+}
+
+// UnmarshalCPP decodes a function saved by the save method of the reference C++
+// implementation (boomphf::mphf<uint64_t, SingleHashFunctor<uint64_t>>). For every key,
+// Find returns the index returned by the C++ lookup method plus one. The decoded
+// BBHash has no reverse map.
+func (bb *BBHash) UnmarshalCPP(data []byte) error {
+	if err := bb.unmarshalCPP(data); err != nil {
+		return fmt.Errorf("BBHash.UnmarshalCPP: %w", err)
+	}
+	return nil
+}
+
+func (bb *BBHash) unmarshalCPP(data []byte) error {
+	d := &cppDecoder{buf: data}
+	gamma := math.Float64frombits(d.uint64())
+	levels := d.uint32()
+	lastRank := d.uint64()
+	keys := d.uint64()
+	if d.err != nil {
+		return d.err
+	}
+	if levels == 0 || levels > maxLevel {
+		return fmt.Errorf("invalid number of levels %d (max %d)", levels, maxLevel)
+	}
+
+	bits := make([]bitVector, levels)
+	var rank uint64
+	for lvl := range bits {
+		size := d.uint64()
+		words := d.length(uint64bytes)
+		if d.err != nil {
+			return d.err
+		}
+		if size == 0 || size%64 != 0 || words != size/64+1 {
+			return fmt.Errorf("level %d: invalid size %d bits in %d words", lvl, size, words)
+		}
+		bv := make(bitVector, words)
+		for i := range bv {
+			bv[i] = d.uint64()
+		}
+		if bv[words-1] != 0 {
+			return fmt.Errorf("level %d: bits set beyond size %d", lvl, size)
+		}
+		bv = bv[:words-1]
+		ranks := d.length(uint64bytes)
+		if d.err == nil && ranks != (words+7)/8 {
+			return fmt.Errorf("level %d: %d rank samples, expected %d", lvl, ranks, (words+7)/8)
+		}
+		wordRanks := append(bv.wordRanks(rank), rank+bv.onesCount())
+		for i := range ranks {
+			if r := d.uint64(); d.err == nil && r != wordRanks[i*cppRankSample/64] {
+				return fmt.Errorf("level %d: invalid rank sample %d", lvl, i)
+			}
+		}
+		bits[lvl] = bv
+		rank += bv.onesCount()
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if bits[levels-1].onesCount() != 0 {
+		return errors.New("bits set in last level")
+	}
+	if lastRank != rank {
+		return fmt.Errorf("rank of last level %d, expected %d", lastRank, rank)
+	}
+
+	finalKeys := d.length(2 * uint64bytes)
+	if d.err == nil && keys != rank+finalKeys {
+		return fmt.Errorf("%d keys, expected %d", keys, rank+finalKeys)
+	}
+	final := make(map[uint64]uint64, finalKeys)
+	for range finalKeys {
+		key, index := d.uint64(), d.uint64()
+		if index >= finalKeys {
+			return fmt.Errorf("last-level index %d out of range [0, %d)", index, finalKeys)
+		}
+		final[key] = index
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if uint64(len(final)) != finalKeys {
+		return errors.New("duplicate key in last level")
+	}
+	if len(d.buf) != 0 {
+		return fmt.Errorf("%d trailing bytes", len(d.buf))
+	}
+
+	*bb = BBHash{bits: bits, cpp: &cppState{gamma: gamma, final: final}} // modify bb in place
+	bb.computeLevelRanks()
+	return nil
+}
+
+// AppendCPP appends the encoding of the BBHash2 in the format of the reference
+// C++ implementation to buf; see BBHash.AppendCPP. The BBHash2 must have been
+// created with the CompatibleHash option, and thus has a single partition.
+func (b2 BBHash2) AppendCPP(buf []byte) ([]byte, error) {
+	if len(b2.partitions) != 1 {
+		return nil, fmt.Errorf("BBHash2.AppendCPP: %d partitions, expected 1", len(b2.partitions))
+	}
+	return b2.partitions[0].AppendCPP(buf)
+}
+
+// MarshalCPP returns the encoding of the BBHash2 in the format of the reference
+// C++ implementation; see BBHash.AppendCPP.
+func (b2 BBHash2) MarshalCPP() ([]byte, error) {
+	if len(b2.partitions) != 1 {
+		return nil, fmt.Errorf("BBHash2.MarshalCPP: %d partitions, expected 1", len(b2.partitions))
+	}
+	return b2.partitions[0].MarshalCPP()
+}
+
+// UnmarshalCPP decodes a function saved by the reference C++ implementation
+// as a BBHash2 with a single partition; see BBHash.UnmarshalCPP.
+func (b2 *BBHash2) UnmarshalCPP(data []byte) error {
+	var bb BBHash
+	if err := bb.unmarshalCPP(data); err != nil {
+		return fmt.Errorf("BBHash2.UnmarshalCPP: %w", err)
+	}
+	*b2 = BBHash2{partitions: []BBHash{bb}, offsets: []uint32{0}} // modify b2 in place
+	return nil
+}
+
+// CompatibleHash reports whether the BBHash2 uses the hash functions of the
+// reference C++ implementation, and can thus be encoded with MarshalCPP.
+func (b2 BBHash2) CompatibleHash() bool {
+	return len(b2.partitions) == 1 && b2.partitions[0].CompatibleHash()
+}
@@ -0,0 +1,256 @@
+package bbhash_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/relab/bbhash"
+	"github.com/relab/bbhash/internal/test"
+)
+
+func TestCPPMarshalUnmarshal(t *testing.T) {
+	sizes := []int{1, 100, 1000, 50_000}
+	tests := []struct {
+		name string
+		opts []bbhash.Options
+	}{
+		{name: "CompatibleHash", opts: []bbhash.Options{bbhash.CompatibleHash()}},
+		{name: "Gamma", opts: []bbhash.Options{bbhash.CompatibleHash(), bbhash.Gamma(1.0)}},
+		{name: "ReverseMap", opts: []bbhash.Options{bbhash.CompatibleHash(), bbhash.WithReverseMap()}},
+	}
+	for _, tt := range tests {
+		for _, size := range sizes {
+			t.Run(test.Name(tt.name, []string{"keys"}, size), func(t *testing.T) {
+				keys := generateKeys(size, 99)
+				bb, err := bbhash.New(keys, tt.opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bb.CompatibleHash() {
+					t.Fatal("CompatibleHash() = false, want true")
+				}
+				if bb.Len() != size {
+					t.Errorf("Len() = %d, want %d", bb.Len(), size)
+				}
+				seen := make([]bool, size+1)
+				for _, key := range keys {
+					index := bb.Find(key)
+					if index == 0 || index > uint64(size) || seen[index] {
+						t.Fatalf("Find(%d) = %d, want unique index in [1, %d]", key, index, size)
+					}
+					seen[index] = true
+					if bb.HasReverseMap() && bb.Key(index) != key {
+						t.Errorf("Key(%d) = %d, want %d", index, bb.Key(index), key)
+					}
+				}
+
+				data, err := bb.MarshalCPP()
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got bbhash.BBHash2
+				if err := got.UnmarshalCPP(data); err != nil {
+					t.Fatal(err)
+				}
+				for _, key := range slices.Concat(keys, generateKeys(1000, 100)) {
+					if got.Find(key) != bb.Find(key) {
+						t.Fatalf("Find(%d) = %d after UnmarshalCPP, want %d", key, got.Find(key), bb.Find(key))
+					}
+				}
+				again, err := got.MarshalCPP()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(again, data) {
+					t.Error("MarshalCPP() after UnmarshalCPP differs from the original encoding")
+				}
+			})
+		}
+	}
+}
+
+// TestCPPGolden checks the encoding of a function built with CompatibleHash against
+// a golden file, and the indices of the decoded function against a golden list of
+// keys and the indices returned by the C++ lookup method (Find(key)-1).
+//
+// To update the golden files, run:
+//
+//	% go test -run TestCPPGolden -update
+func TestCPPGolden(t *testing.T) {
+	keys := generateKeys(1000, 30)
+	binFile := filepath.Join("testdata", "cpp_keys1000.bin")
+	txtFile := filepath.Join("testdata", "cpp_keys1000.txt")
+	if *update {
+		bb, err := bbhash.New(keys, bbhash.CompatibleHash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := bb.MarshalCPP()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var txt strings.Builder
+		for _, key := range keys {
+			fmt.Fprintf(&txt, "%d %d\n", key, bb.Find(key)-1)
+		}
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(binFile, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(txtFile, []byte(txt.String()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	golden, err := os.ReadFile(binFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb, err := bbhash.New(keys, bbhash.CompatibleHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := bb.MarshalCPP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, golden) {
+		t.Errorf("MarshalCPP() differs from %s", binFile)
+	}
+
+	var got bbhash.BBHash2
+	if err := got.UnmarshalCPP(golden); err != nil {
+		t.Fatal(err)
+	}
+	txt, err := os.ReadFile(txtFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(txt)), "\n")
+	if len(lines) != len(keys) {
+		t.Fatalf("%s has %d lines, want %d", txtFile, len(lines), len(keys))
+	}
+	for _, line := range lines {
+		var key, index uint64
+		if _, err := fmt.Sscanf(line, "%d %d", &key, &index); err != nil {
+			t.Fatalf("%s: %q: %v", txtFile, line, err)
+		}
+		if got.Find(key) != index+1 {
+			t.Errorf("Find(%d) = %d, want %d", key, got.Find(key), index+1)
+		}
+	}
+}
+
+// cppEncoding returns a C++ encoding with a single level of 64 bits, holding
+// no bits, so that all keys are in the last-level map with the given indices.
+func cppEncoding(keys, indices []uint64) []byte {
+	buf := binary.LittleEndian.AppendUint64(nil, math.Float64bits(2.0))
+	buf = binary.LittleEndian.AppendUint32(buf, 1)                 // levels
+	buf = binary.LittleEndian.AppendUint64(buf, 0)                 // rank of last level
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(keys))) // keys
+	for _, v := range []uint64{64, 2, 0, 0, 1, 0} {                // size, words, bits, ranks
+		buf = binary.LittleEndian.AppendUint64(buf, v)
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(keys)))
+	for i, key := range keys {
+		buf = binary.LittleEndian.AppendUint64(buf, key)
+		buf = binary.LittleEndian.AppendUint64(buf, indices[i])
+	}
+	return buf
+}
+
+func TestCPPLastLevel(t *testing.T) {
+	keys := []uint64{7, 1 << 63, 42}
+	data := cppEncoding(keys, []uint64{0, 1, 2})
+	var bb bbhash.BBHash2
+	if err := bb.UnmarshalCPP(data); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[uint64]uint64{42: 3, 7: 1, 1 << 63: 2, 8: 0} {
+		if got := bb.Find(key); got != want {
+			t.Errorf("Find(%d) = %d, want %d", key, got, want)
+		}
+	}
+	again, err := bb.MarshalCPP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, data) {
+		t.Error("MarshalCPP() after UnmarshalCPP differs from the original encoding")
+	}
+}
+
+func TestCPPErrors(t *testing.T) {
+	bb, err := bbhash.New(generateKeys(1000, 99), bbhash.CompatibleHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := bb.MarshalCPP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []uint64{42, 7}
+	valid := cppEncoding(keys, []uint64{1, 0})
+	withBits := slices.Clone(valid)
+	binary.LittleEndian.PutUint64(withBits[28+16:], 1) // set a bit in the last level
+	badRank := slices.Clone(valid)
+	binary.LittleEndian.PutUint64(badRank[28+40:], 1)
+	badLevels := slices.Clone(valid)
+	binary.LittleEndian.PutUint32(badLevels[8:], 0)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{name: "NoData", data: nil, wantErr: "insufficient data"},
+		{name: "Truncated", data: data[:len(data)-1], wantErr: "insufficient data"},
+		{name: "TrailingBytes", data: append(slices.Clone(data), 0), wantErr: "trailing bytes"},
+		{name: "Levels", data: badLevels, wantErr: "invalid number of levels"},
+		{name: "LastLevelBits", data: withBits, wantErr: "bits set in last level"},
+		{name: "RankSample", data: badRank, wantErr: "invalid rank sample"},
+		{name: "Duplicate", data: cppEncoding([]uint64{42, 42}, []uint64{1, 0}), wantErr: "duplicate key"},
+		{name: "IndexRange", data: cppEncoding(keys, []uint64{2, 0}), wantErr: "out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got bbhash.BBHash2
+			err := got.UnmarshalCPP(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("UnmarshalCPP() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	native, err := bbhash.New(generateKeys(1000, 99), bbhash.Partitions(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := native.MarshalCPP(); err == nil {
+		t.Error("MarshalCPP() succeeded for a function without CompatibleHash")
+	}
+	if _, err := bb.MarshalBinary(); err == nil {
+		t.Error("MarshalBinary() succeeded for a function with CompatibleHash")
+	}
+	if _, err := bb.MarshalIndexed(); err == nil {
+		t.Error("MarshalIndexed() succeeded for a function with CompatibleHash")
+	}
+	if err := bb.WriteGo(&bytes.Buffer{}, "main", "find"); err == nil {
+		t.Error("WriteGo() succeeded for a function with CompatibleHash")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("New() with CompatibleHash and Partitions did not panic")
+		}
+	}()
+	bbhash.New(generateKeys(2000, 99), bbhash.CompatibleHash(), bbhash.Partitions(2))
+}
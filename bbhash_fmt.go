@@ -16,9 +16,21 @@ func (bb BBHash) String() string {
 		entries := bv.onesCount()
 		b.WriteString(fmt.Sprintf("  %d: %d / %d bits (%s)\n", i, entries, bv.size(), sz))
 	}
+	if bb.HasReverseMap() {
+		b.WriteString(reverseMapString(bb.compressed != nil, bb.ReverseMapBitsPerKey()))
+	}
 	return b.String()
 }
 
+// reverseMapString returns a line describing the reverse map for String.
+func reverseMapString(compressed bool, bitsPerKey float64) string {
+	kind := "uncompressed"
+	if compressed {
+		kind = "compressed"
+	}
+	return fmt.Sprintf("  reverse map: %s, bits per key=%3.1f\n", kind, bitsPerKey)
+}
+
 // Levels returns the number of Levels in the minimal perfect hash.
 func (bb BBHash) Levels() int {
 	return len(bb.bits)
@@ -40,6 +52,7 @@ func (bb BBHash) LevelVectors() [][]uint64 {
 
 // BitVectors returns a Go slice for BBHash's per-level bit vectors.
 // This is intended for testing and debugging; no guarantees are made about the format.
+// To generate a standalone lookup function, use BBHash2.WriteGo.
 func (bb BBHash) BitVectors(varName string) string {
 	var b strings.Builder
 	b.WriteString(fmt.Sprintf("var %s = [][]uint64{\n", varName))
@@ -97,6 +110,9 @@ func (bb BBHash) entries() (sz uint64) {
 	for _, bv := range bb.bits {
 		sz += bv.onesCount()
 	}
+	if bb.cpp != nil {
+		sz += uint64(len(bb.cpp.final))
+	}
 	return sz
 }
 
@@ -29,6 +29,9 @@ func (bb BBHash2) String() string {
 		entries := lvlEntries[lvl]
 		b.WriteString(fmt.Sprintf("  %d: %d / %d bits (%s)\n", lvl, entries, sz, readableSize(sz/8)))
 	}
+	if bb.HasReverseMap() {
+		b.WriteString(reverseMapString(bb.compressedReverseMap(), bb.ReverseMapBitsPerKey()))
+	}
 	return b.String()
 }
 
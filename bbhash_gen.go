@@ -0,0 +1,206 @@
+package bbhash
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"math/bits"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/relab/bbhash/internal/fast"
+)
+
+// WriteGo writes Go source code for a standalone lookup function of the BBHash2 to w.
+// The generated file belongs to package pkg and declares the functions
+//
+//	func <name>Find(key uint64) uint64
+//	func <name>Lookup(key uint64) (uint64, bool)
+//
+// which return the same results as Find and Lookup for every key, including
+// false positives for keys that are not in the original key set. The bit vectors,
+// a per-word rank table and the hash functions are inlined, so the generated code
+// has no dependency on this module. The name's first letter determines whether the
+// lookup functions are exported; the generated data is always unexported.
+func (bb BBHash2) WriteGo(w io.Writer, pkg, name string) error {
+	if !token.IsIdentifier(pkg) {
+		return fmt.Errorf("BBHash2.WriteGo: invalid package name %q", pkg)
+	}
+	if !token.IsIdentifier(name) {
+		return fmt.Errorf("BBHash2.WriteGo: invalid name %q", name)
+	}
+	if len(bb.partitions) == 0 {
+		return fmt.Errorf("BBHash2.WriteGo: no data")
+	}
+	if bb.CompatibleHash() {
+		return fmt.Errorf("BBHash2.WriteGo: created with CompatibleHash")
+	}
+	var buf bytes.Buffer
+	if err := goTemplate.Execute(&buf, bb.genData(pkg, name)); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("BBHash2.WriteGo: %w", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// genData holds the data needed by the code generator templates.
+type genData struct {
+	Package     string
+	Name        string        // name of the lookup function (without the Find suffix)
+	Prefix      string        // prefix for unexported identifiers
+	Partitions  [][]genLevel  // per-partition, per-level bit vectors and rank tables
+	Offsets     []uint32      // key offset of each partition
+	LevelHashes []uint64      // level hash for each level
+	Keys        uint64        // number of keys
+	MaxLevels   int           // maximum number of levels in any partition
+	Stats       string        // summary of the BBHash2
+	Mixer       genMixerConst // constants of the hash functions
+}
+
+// genLevel holds the bit vector and per-word rank table for a level.
+// The rank of word w is the rank of the level plus the number of one bits in the words before w.
+type genLevel struct {
+	Bits  []uint64
+	Ranks []uint32
+}
+
+// genMixerConst holds the constants used by fast.LevelHash and fast.KeyHash.
+type genMixerConst struct {
+	M   uint64
+	Mix uint64
+}
+
+// genData returns the data for the code generator templates.
+func (bb BBHash2) genData(pkg, name string) *genData {
+	r, size := utf8.DecodeRuneInString(name)
+	d := &genData{
+		Package: pkg,
+		Name:    name,
+		Prefix:  string(unicode.ToLower(r)) + name[size:],
+		Offsets: bb.offsets,
+		Keys:    bb.entries(),
+		Stats:   strings.TrimSpace(strings.SplitN(bb.String(), "\n", 2)[0]),
+		Mixer:   genMixerConst{M: fast.M, Mix: fast.MixMultiplier},
+	}
+	for _, bx := range bb.partitions {
+		levels := make([]genLevel, len(bx.bits))
+		for lvl, bv := range bx.bits {
+			ranks := make([]uint32, len(bv))
+			rank := bx.ranks[lvl]
+			for w, v := range bv {
+				ranks[w] = uint32(rank)
+				rank += uint64(bits.OnesCount64(v))
+			}
+			levels[lvl] = genLevel{Bits: bv, Ranks: ranks}
+		}
+		d.Partitions = append(d.Partitions, levels)
+		d.MaxLevels = max(d.MaxLevels, len(bx.bits))
+	}
+	for lvl := range d.MaxLevels {
+		d.LevelHashes = append(d.LevelHashes, fast.LevelHash(uint64(lvl)))
+	}
+	return d
+}
+
+var genFuncs = template.FuncMap{
+	"hex64": func(v uint64) string { return fmt.Sprintf("%#016x", v) },
+}
+
+var goTemplate = template.Must(template.New("go").Funcs(genFuncs).Parse(`// Code generated by bbhash; DO NOT EDIT.
+// {{.Stats}}
+
+package {{.Package}}
+
+import "math/bits"
+
+// {{.Name}}Find returns a unique index in the range [1, {{.Keys}}] for each key in the original key set.
+// For other keys, it returns 0 or a false positive index in the same range.
+func {{.Name}}Find(key uint64) uint64 {
+	p := key % {{len .Partitions}}
+	for lvl, l := range {{.Prefix}}Partitions[p] {
+		h := {{.Prefix}}KeyHash({{.Prefix}}LevelHashes[lvl], key)
+		i := h % (uint64(len(l.bits)) * 64)
+		w, b := i/64, i%64
+		if l.bits[w]&(1<<b) != 0 {
+			return uint64(l.ranks[w]) + uint64(bits.OnesCount64(l.bits[w]<<(64-b))) + {{.Prefix}}Offsets[p]
+		}
+	}
+	return 0
+}
+
+// {{.Name}}Lookup returns the index of the key in the range [1, {{.Keys}}] and true,
+// or 0 and false if the key is not found. As with {{.Name}}Find, a key that is not
+// in the original key set may be reported as found (a false positive).
+func {{.Name}}Lookup(key uint64) (uint64, bool) {
+	index := {{.Name}}Find(key)
+	return index, index != 0
+}
+
+// {{.Prefix}}KeyHash returns the hash of a key given a level hash.
+func {{.Prefix}}KeyHash(levelHash, key uint64) uint64 {
+	h := levelHash
+	h ^= {{.Prefix}}Mix(key)
+	h *= {{hex64 .Mixer.M}}
+	return {{.Prefix}}Mix(h)
+}
+
+// {{.Prefix}}Mix is a compression function for fast hashing.
+func {{.Prefix}}Mix(h uint64) uint64 {
+	h ^= h >> 23
+	h *= {{hex64 .Mixer.Mix}}
+	h ^= h >> 47
+	return h
+}
+
+// {{.Prefix}}Level holds the bit vector of a level and the rank of each of its words.
+type {{.Prefix}}Level struct {
+	bits  []uint64
+	ranks []uint32
+}
+
+// {{.Prefix}}LevelHashes holds the hash of each level.
+var {{.Prefix}}LevelHashes = [{{len .LevelHashes}}]uint64{
+{{- range .LevelHashes}}
+	{{hex64 .}},
+{{- end}}
+}
+
+// {{.Prefix}}Offsets holds the key offset of each partition.
+var {{.Prefix}}Offsets = [{{len .Partitions}}]uint64{
+{{- range .Offsets}}
+	{{.}},
+{{- end}}
+}
+
+// {{.Prefix}}Partitions holds the levels of each partition.
+var {{.Prefix}}Partitions = [{{len .Partitions}}][]{{$.Prefix}}Level{
+{{- range $p, $levels := .Partitions}}
+	// Partition {{$p}}
+	{
+	{{- range $lvl, $l := $levels}}
+		// Level {{$lvl}}
+		{
+			bits: []uint64{
+			{{- range $l.Bits}}
+				{{hex64 .}},
+			{{- end}}
+			},
+			ranks: []uint32{
+			{{- range $l.Ranks}}
+				{{.}},
+			{{- end}}
+			},
+		},
+	{{- end}}
+	},
+{{- end}}
+}
+`))
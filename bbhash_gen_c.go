@@ -0,0 +1,186 @@
+package bbhash
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// cIdentifier matches valid C identifiers.
+var cIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// WriteC writes C source code for a standalone lookup function of the BBHash2.
+// The header is written to h and should be saved as <name>.h, since the source
+// written to c includes it by that name. The header declares the functions
+//
+//	uint64_t <name>_find(uint64_t key);
+//	bool <name>_lookup(uint64_t key, uint64_t *index);
+//
+// which return the same results as Find and Lookup for every key, including
+// false positives for keys that are not in the original key set; <name>_lookup
+// stores the index in *index. The generated code only depends on the C99
+// standard library.
+func (bb BBHash2) WriteC(h, c io.Writer, name string) error {
+	if !cIdentifier.MatchString(name) {
+		return fmt.Errorf("BBHash2.WriteC: invalid name %q", name)
+	}
+	if len(bb.partitions) == 0 {
+		return fmt.Errorf("BBHash2.WriteC: no data")
+	}
+	if bb.CompatibleHash() {
+		return fmt.Errorf("BBHash2.WriteC: created with CompatibleHash")
+	}
+	d := bb.genData("", name)
+	d.Prefix = name
+	if err := cHeaderTemplate.Execute(h, d); err != nil {
+		return err
+	}
+	return cSourceTemplate.Execute(c, d)
+}
+
+var cFuncs = template.FuncMap{
+	"hex64": func(v uint64) string { return fmt.Sprintf("UINT64_C(%#016x)", v) },
+	"upper": strings.ToUpper,
+}
+
+var cHeaderTemplate = template.Must(template.New("h").Funcs(cFuncs).Parse(`/* Code generated by bbhash; DO NOT EDIT. */
+/* {{.Stats}} */
+
+#ifndef {{upper .Prefix}}_H
+#define {{upper .Prefix}}_H
+
+#include <stdbool.h>
+#include <stdint.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+/*
+ * {{.Prefix}}_find returns a unique index in the range [1, {{.Keys}}] for each key in the original key set.
+ * For other keys, it returns 0 or a false positive index in the same range.
+ */
+uint64_t {{.Prefix}}_find(uint64_t key);
+
+/*
+ * {{.Prefix}}_lookup stores the index of the key in the range [1, {{.Keys}}] in *index and
+ * returns true, or stores 0 and returns false if the key is not found. As with
+ * {{.Prefix}}_find, a key that is not in the original key set may be reported as found.
+ */
+bool {{.Prefix}}_lookup(uint64_t key, uint64_t *index);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif /* {{upper .Prefix}}_H */
+`))
+
+var cSourceTemplate = template.Must(template.New("c").Funcs(cFuncs).Parse(`/* Code generated by bbhash; DO NOT EDIT. */
+/* {{.Stats}} */
+
+#include "{{.Prefix}}.h"
+
+/* {{.Prefix}}_level holds the bit vector of a level and the rank of each of its words. */
+struct {{.Prefix}}_level {
+	const uint64_t *bits;
+	const uint32_t *ranks;
+	uint64_t words;
+};
+
+/* {{.Prefix}}_partition holds the levels of a partition and its key offset. */
+struct {{.Prefix}}_partition {
+	const struct {{.Prefix}}_level *levels;
+	uint32_t num_levels;
+	uint64_t offset;
+};
+
+/* {{.Prefix}}_mix is a compression function for fast hashing. */
+static uint64_t {{.Prefix}}_mix(uint64_t h)
+{
+	h ^= h >> 23;
+	h *= {{hex64 .Mixer.Mix}};
+	h ^= h >> 47;
+	return h;
+}
+
+/* {{.Prefix}}_key_hash returns the hash of a key given a level hash. */
+static uint64_t {{.Prefix}}_key_hash(uint64_t level_hash, uint64_t key)
+{
+	uint64_t h = level_hash;
+	h ^= {{.Prefix}}_mix(key);
+	h *= {{hex64 .Mixer.M}};
+	return {{.Prefix}}_mix(h);
+}
+
+/* {{.Prefix}}_popcount returns the number of one bits in v. */
+static uint64_t {{.Prefix}}_popcount(uint64_t v)
+{
+#if defined(__GNUC__) || defined(__clang__)
+	return (uint64_t)__builtin_popcountll(v);
+#else
+	v = v - ((v >> 1) & UINT64_C(0x5555555555555555));
+	v = (v & UINT64_C(0x3333333333333333)) + ((v >> 2) & UINT64_C(0x3333333333333333));
+	v = (v + (v >> 4)) & UINT64_C(0x0f0f0f0f0f0f0f0f);
+	return (v * UINT64_C(0x0101010101010101)) >> 56;
+#endif
+}
+
+/* {{.Prefix}}_level_hashes holds the hash of each level. */
+static const uint64_t {{.Prefix}}_level_hashes[{{len .LevelHashes}}] = {
+{{- range .LevelHashes}}
+	{{hex64 .}},
+{{- end}}
+};
+{{range $p, $levels := .Partitions}}
+/* Partition {{$p}} */
+{{- range $lvl, $l := $levels}}
+static const uint64_t {{$.Prefix}}_p{{$p}}_l{{$lvl}}_bits[{{len $l.Bits}}] = {
+{{- range $l.Bits}}
+	{{hex64 .}},
+{{- end}}
+};
+static const uint32_t {{$.Prefix}}_p{{$p}}_l{{$lvl}}_ranks[{{len $l.Ranks}}] = {
+{{- range $l.Ranks}}
+	{{.}}u,
+{{- end}}
+};
+{{- end}}
+static const struct {{$.Prefix}}_level {{$.Prefix}}_p{{$p}}_levels[{{len $levels}}] = {
+{{- range $lvl, $l := $levels}}
+	{ {{$.Prefix}}_p{{$p}}_l{{$lvl}}_bits, {{$.Prefix}}_p{{$p}}_l{{$lvl}}_ranks, {{len $l.Bits}} },
+{{- end}}
+};
+{{end}}
+/* {{.Prefix}}_partitions holds the levels and key offset of each partition. */
+static const struct {{.Prefix}}_partition {{.Prefix}}_partitions[{{len .Partitions}}] = {
+{{- range $p, $levels := .Partitions}}
+	{ {{$.Prefix}}_p{{$p}}_levels, {{len $levels}}, {{index $.Offsets $p}} },
+{{- end}}
+};
+
+uint64_t {{.Prefix}}_find(uint64_t key)
+{
+	const struct {{.Prefix}}_partition *p = &{{.Prefix}}_partitions[key % {{len .Partitions}}];
+	uint32_t lvl;
+	for (lvl = 0; lvl < p->num_levels; lvl++) {
+		const struct {{.Prefix}}_level *l = &p->levels[lvl];
+		uint64_t h = {{.Prefix}}_key_hash({{.Prefix}}_level_hashes[lvl], key);
+		uint64_t i = h % (l->words * 64);
+		uint64_t w = i / 64;
+		uint64_t bit = UINT64_C(1) << (i % 64);
+		if (l->bits[w] & bit) {
+			return l->ranks[w] + {{.Prefix}}_popcount(l->bits[w] & (bit - 1)) + p->offset;
+		}
+	}
+	return 0;
+}
+
+bool {{.Prefix}}_lookup(uint64_t key, uint64_t *index)
+{
+	*index = {{.Prefix}}_find(key);
+	return *index != 0;
+}
+`))
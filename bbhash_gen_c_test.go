@@ -0,0 +1,108 @@
+package bbhash_test
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/relab/bbhash"
+	"github.com/relab/bbhash/internal/test"
+)
+
+func TestWriteC(t *testing.T) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("C compiler not found")
+	}
+	testCases := []struct {
+		size       int
+		partitions int
+	}{
+		{size: 100, partitions: 1},
+		{size: 2000, partitions: 4},
+	}
+	for _, tc := range testCases {
+		t.Run(test.Name("", []string{"keys", "partitions"}, tc.size, tc.partitions), func(t *testing.T) {
+			keys := generateKeys(tc.size, 98)
+			bb, err := bbhash.New(keys, bbhash.Partitions(tc.partitions))
+			if err != nil {
+				t.Fatalf("Failed to create BBHash2: %v", err)
+			}
+
+			dir := t.TempDir()
+			var h, c strings.Builder
+			if err := bb.WriteC(&h, &c, "bbhash"); err != nil {
+				t.Fatalf("WriteC() failed: %v", err)
+			}
+			writeFile(t, filepath.Join(dir, "bbhash.h"), h.String())
+			writeFile(t, filepath.Join(dir, "bbhash.c"), c.String())
+
+			// The harness prints the results of bbhash_find and bbhash_lookup for each key,
+			// followed by those of some unknown keys
+			unknown := generateKeys(100, 99)
+			all := slices.Concat(keys, unknown)
+			var harness strings.Builder
+			harness.WriteString("#include <inttypes.h>\n#include <stdio.h>\n#include \"bbhash.h\"\n\n")
+			fmt.Fprintf(&harness, "static const uint64_t keys[%d] = {\n", len(all))
+			for _, k := range all {
+				fmt.Fprintf(&harness, "\tUINT64_C(%d),\n", k)
+			}
+			harness.WriteString("};\n\nint main(void)\n{\n")
+			harness.WriteString("\tfor (size_t i = 0; i < sizeof(keys) / sizeof(keys[0]); i++) {\n")
+			harness.WriteString("\t\tuint64_t index = 1;\n\t\tbool ok = bbhash_lookup(keys[i], &index);\n")
+			harness.WriteString("\t\tprintf(\"%\" PRIu64 \" %\" PRIu64 \" %d\\n\", bbhash_find(keys[i]), index, ok);\n\t}\n\treturn 0;\n}\n")
+			writeFile(t, filepath.Join(dir, "main.c"), harness.String())
+
+			bin := filepath.Join(dir, "lookup")
+			cmd := exec.Command(cc, "-std=c99", "-Wall", "-Wextra", "-Werror", "-O2", "-o", bin, "main.c", "bbhash.c")
+			cmd.Dir = dir
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("%s failed: %v\n%s", cc, err, out)
+			}
+			out, err := exec.Command(bin).Output()
+			if err != nil {
+				t.Fatalf("running harness failed: %v", err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+			if len(lines) != len(all) {
+				t.Fatalf("got %d lines of output, want %d", len(lines), len(all))
+			}
+			var notFound int
+			for i, k := range all {
+				var find, lookup uint64
+				var ok int
+				if _, err := fmt.Sscan(lines[i], &find, &lookup, &ok); err != nil {
+					t.Fatalf("line %d: %v", i, err)
+				}
+				if want := bb.Find(k); find != want {
+					t.Errorf("bbhash_find(%d) = %d, want %d", k, find, want)
+				}
+				if want, wantOK := bb.Lookup(k); lookup != want || (ok != 0) != wantOK {
+					t.Errorf("bbhash_lookup(%d) = %d, %t, want %d, %t", k, lookup, ok != 0, want, wantOK)
+				}
+				if i >= len(keys) && ok == 0 {
+					notFound++
+				}
+			}
+			if notFound == 0 {
+				t.Error("all unknown keys were found, want some not found")
+			}
+		})
+	}
+}
+
+func TestWriteCInvalidName(t *testing.T) {
+	bb, err := bbhash.New(generateKeys(100, 98))
+	if err != nil {
+		t.Fatalf("Failed to create BBHash2: %v", err)
+	}
+	for _, name := range []string{"", "1x", "my-func"} {
+		if err := bb.WriteC(io.Discard, io.Discard, name); err == nil {
+			t.Errorf("WriteC(%q) should have failed", name)
+		}
+	}
+}
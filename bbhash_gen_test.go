@@ -0,0 +1,112 @@
+package bbhash_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/relab/bbhash"
+	"github.com/relab/bbhash/internal/test"
+)
+
+func TestWriteGo(t *testing.T) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	testCases := []struct {
+		size       int
+		partitions int
+	}{
+		{size: 100, partitions: 1},
+		{size: 2000, partitions: 4},
+	}
+	for _, tc := range testCases {
+		t.Run(test.Name("", []string{"keys", "partitions"}, tc.size, tc.partitions), func(t *testing.T) {
+			keys := generateKeys(tc.size, 98)
+			bb, err := bbhash.New(keys, bbhash.Partitions(tc.partitions))
+			if err != nil {
+				t.Fatalf("Failed to create BBHash2: %v", err)
+			}
+
+			dir := t.TempDir()
+			var src bytes.Buffer
+			if err := bb.WriteGo(&src, "main", "mphf"); err != nil {
+				t.Fatalf("WriteGo() failed: %v", err)
+			}
+			writeFile(t, filepath.Join(dir, "mphf_bbhash.go"), src.String())
+			writeFile(t, filepath.Join(dir, "go.mod"), "module gentest\n\ngo 1.24\n")
+
+			// The harness prints the results of mphfFind and mphfLookup for each key,
+			// followed by those of some unknown keys
+			unknown := generateKeys(100, 99)
+			all := slices.Concat(keys, unknown)
+			var harness strings.Builder
+			harness.WriteString("package main\n\nimport \"fmt\"\n\nfunc main() {\n")
+			for _, k := range all {
+				fmt.Fprintf(&harness, "\tfmt.Println(mphfFind(%d))\n\tfmt.Println(mphfLookup(%d))\n", k, k)
+			}
+			harness.WriteString("}\n")
+			writeFile(t, filepath.Join(dir, "main.go"), harness.String())
+
+			cmd := exec.Command(goTool, "run", ".")
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=")
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("go run failed: %v\n%s", err, out)
+			}
+			lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+			if len(lines) != 2*len(all) {
+				t.Fatalf("got %d lines of output, want %d", len(lines), 2*len(all))
+			}
+			var notFound int
+			for i, k := range all {
+				var find, lookup uint64
+				var ok bool
+				if _, err := fmt.Sscan(lines[2*i], &find); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := fmt.Sscan(lines[2*i+1], &lookup, &ok); err != nil {
+					t.Fatal(err)
+				}
+				if want := bb.Find(k); find != want {
+					t.Errorf("mphfFind(%d) = %d, want %d", k, find, want)
+				}
+				if want, wantOK := bb.Lookup(k); lookup != want || ok != wantOK {
+					t.Errorf("mphfLookup(%d) = %d, %t, want %d, %t", k, lookup, ok, want, wantOK)
+				}
+				if i >= len(keys) && !ok {
+					notFound++
+				}
+			}
+			if notFound == 0 {
+				t.Error("all unknown keys were found, want some not found")
+			}
+		})
+	}
+}
+
+func TestWriteGoInvalidNames(t *testing.T) {
+	bb, err := bbhash.New(generateKeys(100, 98))
+	if err != nil {
+		t.Fatalf("Failed to create BBHash2: %v", err)
+	}
+	for _, name := range [][2]string{{"main", "1x"}, {"my-pkg", "x"}, {"main", ""}} {
+		if err := bb.WriteGo(&bytes.Buffer{}, name[0], name[1]); err == nil {
+			t.Errorf("WriteGo(%q, %q) should have failed", name[0], name[1])
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o666); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -6,6 +6,10 @@ package bbhash
 type bbhash interface {
 	// Find returns the index of the key in the BBHash.
 	Find(key uint64) uint64
+	// Lookup returns the index of the key in the BBHash and whether it was found.
+	Lookup(key uint64) (uint64, bool)
+	// Index returns the 0-based index of the key in the BBHash and whether it was found.
+	Index(key uint64) (uint64, bool)
 }
 
 // reverseMap is an interface for a reverse map, which must
@@ -13,4 +17,12 @@ type bbhash interface {
 type reverseMap interface {
 	// Key returns the key for the given index.
 	Key(index uint64) uint64
+	// LookupKey returns the key for the given index and whether the index is valid.
+	LookupKey(index uint64) (uint64, bool)
+	// FindExact returns the index of the key, without false positives.
+	FindExact(key uint64) (uint64, bool)
+	// Contains returns true if the key is in the original key set.
+	Contains(key uint64) bool
+	// HasReverseMap returns true if the reverse map is available.
+	HasReverseMap() bool
 }
@@ -0,0 +1,201 @@
+package bbhash
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+)
+
+// Inspection describes the layout of an encoded BBHash or BBHash2, including any
+// text, JSON or signature envelope around the binary encoding. It is intended for
+// tools that debug or compare serialized functions; see Inspect.
+type Inspection struct {
+	// Type is "BBHash" or "BBHash2".
+	Type string
+	// Encoding is "default" or "indexed"; see AppendBinary and AppendIndexed.
+	Encoding string
+	// Version is the version of the indexed encoding, or 0 for the default encoding.
+	Version int
+	// ReverseMap is true if the encoding holds a reverse map.
+	ReverseMap bool
+	// CompressedReverseMap is true if the reverse map is compressed.
+	CompressedReverseMap bool
+
+	// Envelope describes the text or JSON envelope, or is nil if there is none.
+	Envelope *EnvelopeInfo
+	// Signature describes the embedded signature, or is nil if there is none.
+	Signature *SignatureInfo
+
+	// Payload is the binary encoding, without any envelope or signature.
+	Payload []byte
+	// HeaderLength is the length of the header of the binary encoding.
+	HeaderLength int
+	// IndexLength is the length of the partition index of the indexed encoding.
+	IndexLength int
+	// OffsetsLength is the length of the partition key offsets of the default encoding.
+	OffsetsLength int
+	// Partitions describes the partitions; a BBHash has a single partition.
+	Partitions []PartitionInfo
+}
+
+// PartitionInfo describes the encoding of a partition.
+type PartitionInfo struct {
+	// Offset is the number of keys in the preceding partitions.
+	Offset uint64
+	// Length is the encoded length of the partition, including its reverse map.
+	Length int
+	// ReverseMapLength is the encoded length of the partition's reverse map.
+	ReverseMapLength int
+}
+
+// EnvelopeInfo describes a text or JSON envelope; see MarshalText.
+type EnvelopeInfo struct {
+	// Format is "text" or "json".
+	Format string
+	// Version is the version of the envelope.
+	Version int
+	// Keys is the number of keys recorded in the envelope.
+	Keys uint64
+	// Checksum is the CRC-32C checksum recorded in the envelope.
+	Checksum string
+	// ChecksumValid is true if the checksum matches the binary encoding.
+	ChecksumValid bool
+}
+
+// SignatureInfo describes the embedded signature of an encoding; see MarshalSigned.
+type SignatureInfo struct {
+	msg []byte // the signed header and payload
+	sig []byte
+}
+
+// Verify returns true if the signature is a valid signature by pub.
+func (s *SignatureInfo) Verify(pub ed25519.PublicKey) bool {
+	return len(pub) == ed25519.PublicKeySize && ed25519.Verify(pub, s.msg, s.sig)
+}
+
+// Inspect describes the encoding of a BBHash2 in data, which may be the default,
+// indexed, signed, text or JSON encoding. Text and JSON envelopes record the type,
+// so data may also hold an envelope of a BBHash. Inspect checks the layout of the
+// encoding, but does not decode the bit vectors, and reports an invalid envelope
+// checksum in Envelope.ChecksumValid rather than as an error.
+func Inspect(data []byte) (*Inspection, error) {
+	return inspect(data, "BBHash2")
+}
+
+// InspectBBHash is like Inspect, but describes the binary encoding of a BBHash.
+func InspectBBHash(data []byte) (*Inspection, error) {
+	return inspect(data, "BBHash")
+}
+
+// inspect describes the encoding in data; typ is the type of a binary encoding.
+func inspect(data []byte, typ string) (*Inspection, error) {
+	in := &Inspection{Type: typ, Payload: data}
+	if e, format := parseEnvelope(data); e != nil {
+		switch e.Type {
+		case textTypeBBHash:
+			in.Type = "BBHash"
+		case textTypeBBHash2:
+			in.Type = "BBHash2"
+		default:
+			return nil, fmt.Errorf("bbhash.Inspect: unknown envelope type %q", e.Type)
+		}
+		in.Envelope = &EnvelopeInfo{
+			Format:        format,
+			Version:       e.Version,
+			Keys:          e.Keys,
+			Checksum:      e.Checksum,
+			ChecksumValid: e.Checksum == checksum(e.Data),
+		}
+		in.Payload = e.Data
+	} else {
+		payload, sig, signed, err := splitSigned(data)
+		if err != nil {
+			return nil, fmt.Errorf("bbhash.Inspect: %w", err)
+		}
+		if signed {
+			in.Type = "BBHash2"
+			in.Signature = &SignatureInfo{msg: data[:len(data)-len(sig)], sig: sig}
+			in.Payload = payload
+		}
+	}
+	if len(in.Payload) == 0 {
+		return nil, errors.New("bbhash.Inspect: no data")
+	}
+	if err := in.inspectPayload(); err != nil {
+		return nil, fmt.Errorf("bbhash.Inspect: %w", err)
+	}
+	return in, nil
+}
+
+// parseEnvelope returns the text or JSON envelope in data and its format,
+// or nil if data is not an envelope.
+func parseEnvelope(data []byte) (*textEnvelope, string) {
+	text := bytes.TrimSpace(data)
+	if len(text) == 0 {
+		return nil, ""
+	}
+	if text[0] == '{' || text[0] == '"' {
+		if e, err := parseJSONEnvelope(text); err == nil {
+			return e, "json"
+		}
+		return nil, ""
+	}
+	if e, err := parseTextEnvelope(text); err == nil && bytes.HasPrefix(text, []byte(textTypeBBHash)) {
+		return e, "text"
+	}
+	return nil, ""
+}
+
+// inspectPayload describes the header and partitions of the binary encoding in the payload.
+func (in *Inspection) inspectPayload() error {
+	data := in.Payload
+	in.Encoding = "default"
+	if in.Type == "BBHash" {
+		bbLen, err := scanPartition(data)
+		if err != nil {
+			return err
+		}
+		if bbLen != uint64(len(data)) {
+			return fmt.Errorf("encoded length %d does not match data length %d", bbLen, len(data))
+		}
+		in.Partitions = []PartitionInfo{{Length: len(data)}}
+		return nil
+	}
+
+	var idx *partitionIndex
+	var err error
+	if data[0] == indexedMarker {
+		if idx, err = decodeIndex(data, uint64(len(data))); err != nil {
+			return err
+		}
+		in.Encoding = "indexed"
+		in.Version = int(data[1])
+		in.ReverseMap = idx.flags&flagReverseMap != 0
+		in.CompressedReverseMap = idx.flags&flagCompressedReverseMap != 0
+		in.HeaderLength = indexedHeaderLength
+		in.IndexLength = indexEntryLength * len(idx.offsets)
+	} else {
+		if idx, err = scanIndex(data); err != nil {
+			return err
+		}
+		if uint64(len(data)) < idx.end() {
+			return errors.New("insufficient data for remaining partitions")
+		}
+		in.HeaderLength = 1
+		in.OffsetsLength = uint32bytes * (len(idx.offsets) - 1)
+	}
+	for i := range idx.offsets {
+		start, length := idx.starts[i], idx.lengths[i]
+		bbLen, err := scanPartition(data[start : start+length])
+		if err != nil {
+			return fmt.Errorf("partition %d: %w", i, err)
+		}
+		in.Partitions = append(in.Partitions, PartitionInfo{
+			Offset:           uint64(idx.offsets[i]),
+			Length:           int(length),
+			ReverseMapLength: int(length - bbLen),
+		})
+	}
+	return nil
+}
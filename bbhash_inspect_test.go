@@ -0,0 +1,150 @@
+package bbhash_test
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/relab/bbhash"
+)
+
+func TestInspect(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := generateKeys(5000, 98)
+	plain, err := bbhash.New(keys, bbhash.Partitions(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	withMap, err := bbhash.New(keys, bbhash.Partitions(4), bbhash.WithReverseMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := bbhash.New(keys, bbhash.Partitions(4), bbhash.WithCompressedReverseMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq, err := bbhash.New(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	single := seq.SinglePartition()
+	must := func(data []byte, err error) []byte {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name       string
+		data       []byte
+		bbhash     bool // inspect as a binary BBHash
+		typ        string
+		encoding   string
+		reverseMap bool
+		compressed bool
+		envelope   string
+		signed     bool
+		partitions int
+	}{
+		{name: "default", data: must(plain.MarshalBinary()), typ: "BBHash2", encoding: "default", partitions: 4},
+		{name: "indexed", data: must(plain.MarshalIndexed()), typ: "BBHash2", encoding: "indexed", partitions: 4},
+		{name: "reverse map", data: must(withMap.MarshalIndexed()), typ: "BBHash2", encoding: "indexed", reverseMap: true, partitions: 4},
+		{name: "compressed", data: must(compressed.MarshalIndexed()), typ: "BBHash2", encoding: "indexed", reverseMap: true, compressed: true, partitions: 4},
+		{name: "text", data: must(withMap.MarshalText()), typ: "BBHash2", encoding: "indexed", reverseMap: true, envelope: "text", partitions: 4},
+		{name: "json", data: must(plain.MarshalJSON()), typ: "BBHash2", encoding: "indexed", envelope: "json", partitions: 4},
+		{name: "signed", data: must(withMap.MarshalSigned(priv)), typ: "BBHash2", encoding: "indexed", reverseMap: true, signed: true, partitions: 4},
+		{name: "BBHash", data: must(single.MarshalBinary()), bbhash: true, typ: "BBHash", encoding: "default", partitions: 1},
+		{name: "BBHash/text", data: must(single.MarshalText()), typ: "BBHash", encoding: "default", envelope: "text", partitions: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inspect := bbhash.Inspect
+			if tt.bbhash {
+				inspect = bbhash.InspectBBHash
+			}
+			in, err := inspect(tt.data)
+			if err != nil {
+				t.Fatalf("Inspect() failed: %v", err)
+			}
+			if in.Type != tt.typ || in.Encoding != tt.encoding || in.ReverseMap != tt.reverseMap || in.CompressedReverseMap != tt.compressed {
+				t.Errorf("Inspect() = {%s, %s, reverse map %t, compressed %t}, want {%s, %s, %t, %t}",
+					in.Type, in.Encoding, in.ReverseMap, in.CompressedReverseMap, tt.typ, tt.encoding, tt.reverseMap, tt.compressed)
+			}
+			if len(in.Partitions) != tt.partitions {
+				t.Fatalf("len(Partitions) = %d, want %d", len(in.Partitions), tt.partitions)
+			}
+
+			length := in.HeaderLength + in.IndexLength + in.OffsetsLength
+			var offset uint64
+			for i, p := range in.Partitions {
+				if p.Offset < offset {
+					t.Errorf("partition %d: offset %d less than previous offset %d", i, p.Offset, offset)
+				}
+				if (p.ReverseMapLength > 0) != tt.reverseMap {
+					t.Errorf("partition %d: ReverseMapLength = %d, want reverse map %t", i, p.ReverseMapLength, tt.reverseMap)
+				}
+				offset = p.Offset
+				length += p.Length
+			}
+			if length != len(in.Payload) {
+				t.Errorf("layout length = %d, want payload length %d", length, len(in.Payload))
+			}
+
+			switch {
+			case tt.envelope == "":
+				if in.Envelope != nil {
+					t.Errorf("Envelope = %+v, want nil", in.Envelope)
+				}
+			case in.Envelope == nil || in.Envelope.Format != tt.envelope || !in.Envelope.ChecksumValid || in.Envelope.Keys != uint64(len(keys)):
+				t.Errorf("Envelope = %+v, want valid %s envelope with %d keys", in.Envelope, tt.envelope, len(keys))
+			}
+			if (in.Signature != nil) != tt.signed {
+				t.Fatalf("Signature = %v, want signed %t", in.Signature, tt.signed)
+			}
+			if tt.signed && (!in.Signature.Verify(pub) || in.Signature.Verify(otherPub)) {
+				t.Error("Signature.Verify() accepted the wrong key or refused the right one")
+			}
+		})
+	}
+}
+
+func TestInspectErrors(t *testing.T) {
+	bb, err := bbhash.New(generateKeys(1000, 98))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := bb.MarshalIndexed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := bb.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := []byte(string(text[:len("bbhash2:v1:1000:")]) + "00000000" + string(text[len("bbhash2:v1:1000:00000000"):]))
+
+	if _, err := bbhash.Inspect(nil); err == nil {
+		t.Error("Inspect() should have failed for no data")
+	}
+	if _, err := bbhash.Inspect(data[:len(data)-1]); err == nil {
+		t.Error("Inspect() should have failed for a truncated encoding")
+	}
+	if _, err := bbhash.Inspect([]byte("BBHS\x02")); err == nil {
+		t.Error("Inspect() should have failed for a malformed signed header")
+	}
+	in, err := bbhash.Inspect(corrupt)
+	if err != nil {
+		t.Fatalf("Inspect() failed for a checksum mismatch: %v", err)
+	}
+	if in.Envelope == nil || in.Envelope.ChecksumValid {
+		t.Errorf("Envelope = %+v, want invalid checksum", in.Envelope)
+	}
+}
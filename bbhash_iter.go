@@ -3,30 +3,224 @@ package bbhash
 import (
 	"crypto/sha256"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"iter"
+	"math/bits"
 
 	"github.com/relab/bbhash/internal/fast"
 )
 
-// Find the chunks from slow memory
-// Chunks returns smaller chunks of data given a reader with some data already being read and with the buffer size.
-func ReadChunks(readerInfo io.Reader, bufSz int) iter.Seq[[]byte] {
+// Chunk is a chunk of data read from a reader.
+type Chunk struct {
+	// Offset is the offset of the chunk's first byte in the input.
+	Offset int64
+	// Data holds the chunk's data; its length is the length of the chunk.
+	// Unless the OwnedBuffers option is used, Data is only valid until
+	// the next chunk is yielded.
+	Data []byte
+}
+
+// ChunkOptions are options for the chunk iterators.
+type ChunkOptions func(*chunkOptions)
+
+type chunkOptions struct {
+	owned bool
+}
+
+func newChunkOptions(opts ...ChunkOptions) *chunkOptions {
+	o := &chunkOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// OwnedBuffers makes the chunk iterators allocate a new buffer for each chunk,
+// so that the caller may keep the chunks after the iteration continues.
+// By default, the iterators reuse a single buffer.
+func OwnedBuffers() ChunkOptions {
+	return func(o *chunkOptions) {
+		o.owned = true
+	}
+}
+
+// ReadChunks returns the chunks of size bufSz read from r; the last chunk may be shorter.
+// Chunk boundaries do not depend on how much data each call to r.Read returns.
+// The iteration stops at the end of the input or on the first read error;
+// use FixedChunks to observe read errors. Unless the OwnedBuffers option is used,
+// the yielded slices share a buffer and are only valid until the next chunk is yielded.
+func ReadChunks(r io.Reader, bufSz int, opts ...ChunkOptions) iter.Seq[[]byte] {
 	return func(yield func([]byte) bool) {
-		buffer := make([]byte, bufSz)
+		for c, err := range FixedChunks(r, bufSz, opts...) {
+			if err != nil || !yield(c.Data) {
+				return
+			}
+		}
+	}
+}
+
+// FixedChunks returns the chunks of the given size read from r, with their offsets;
+// the last chunk may be shorter. If reading from r fails, the error is yielded with
+// an empty chunk and the iteration stops.
+func FixedChunks(r io.Reader, size int, opts ...ChunkOptions) iter.Seq2[Chunk, error] {
+	o := newChunkOptions(opts...)
+	return func(yield func(Chunk, error) bool) {
+		if size <= 0 {
+			yield(Chunk{}, fmt.Errorf("bbhash.FixedChunks: invalid chunk size %d", size))
+			return
+		}
+		buf := make([]byte, size)
+		var offset int64
 		for {
-			// Create buffer and read the input into it for a certain range of bytes
-			n, err := readerInfo.Read(buffer)
-			if err != nil {
+			if o.owned {
+				buf = make([]byte, size)
+			}
+			n, err := io.ReadFull(r, buf)
+			if n > 0 {
+				if !yield(Chunk{Offset: offset, Data: buf[:n]}, nil) {
+					return
+				}
+				offset += int64(n)
+			}
+			switch {
+			case err == io.EOF || err == io.ErrUnexpectedEOF:
+				return
+			case err != nil:
+				yield(Chunk{}, err)
 				return
 			}
-			if !yield(buffer[:n]) {
+		}
+	}
+}
+
+// ContentDefinedChunks returns the chunks read from r using content-defined chunking,
+// with their offsets. Chunk boundaries are determined by the content, using the
+// FastCDC algorithm with normalized chunking: chunks are at least minSize and at most
+// maxSize bytes long, except the last chunk, and their average size is about avgSize.
+// Since boundaries depend only on nearby content, inserting or removing data only
+// changes the chunks around the modification, which makes the chunks suitable for
+// deduplication. If reading from r fails, the chunks of the data read before the
+// failure are yielded, followed by the error with an empty chunk, and the iteration
+// stops. A reader that repeatedly returns no data and no error fails with
+// [io.ErrNoProgress].
+//
+// The sizes must satisfy 0 < minSize <= avgSize <= maxSize, and avgSize must be at least 2.
+// The chunk boundaries for a given input and sizes are stable across releases.
+func ContentDefinedChunks(r io.Reader, minSize, avgSize, maxSize int, opts ...ChunkOptions) iter.Seq2[Chunk, error] {
+	o := newChunkOptions(opts...)
+	return func(yield func(Chunk, error) bool) {
+		if minSize <= 0 || minSize > avgSize || avgSize > maxSize || avgSize < 2 {
+			yield(Chunk{}, fmt.Errorf("bbhash.ContentDefinedChunks: invalid sizes min=%d, avg=%d, max=%d", minSize, avgSize, maxSize))
+			return
+		}
+		c := newCDC(minSize, avgSize, maxSize)
+		buf := make([]byte, 0, 2*maxSize)
+		var offset int64
+		var readErr error
+		emptyReads := 0
+		for {
+			// Fill the buffer with at least maxSize bytes, unless the input is exhausted.
+			for len(buf) < maxSize && readErr == nil {
+				var n int
+				n, readErr = r.Read(buf[len(buf):cap(buf)])
+				buf = buf[:len(buf)+n]
+				if n > 0 || readErr != nil {
+					emptyReads = 0
+				} else if emptyReads++; emptyReads == maxEmptyReads {
+					readErr = io.ErrNoProgress
+				}
+			}
+			// After a read error, the buffered data is chunked as if it was the end
+			// of the input, and the error is yielded once the buffer is empty.
+			if len(buf) == 0 {
+				if readErr != io.EOF {
+					yield(Chunk{}, readErr)
+				}
+				return
+			}
+			n := c.cut(buf)
+			data := buf[:n]
+			if o.owned {
+				data = append([]byte(nil), data...)
+			}
+			if !yield(Chunk{Offset: offset, Data: data}, nil) {
 				return
 			}
+			offset += int64(n)
+			// Move the remaining data to the start of the buffer.
+			buf = buf[:copy(buf, buf[n:])]
 		}
 	}
 }
 
+// maxEmptyReads is the number of consecutive reads returning no data and no error
+// after which ContentDefinedChunks fails with io.ErrNoProgress.
+const maxEmptyReads = 100
+
+// cdc holds the parameters of the FastCDC algorithm.
+type cdc struct {
+	minSize, avgSize, maxSize int
+	maskS, maskL              uint64 // masks for chunks shorter and longer than avgSize
+}
+
+// newCDC returns the FastCDC parameters for the given sizes. The masks use the most
+// significant bits of the gear hash, which depend on the last 64 bytes of input.
+// Normalized chunking uses one more mask bit before avgSize and one less after it,
+// making chunks shorter than avgSize less likely and chunks longer than avgSize more likely.
+func newCDC(minSize, avgSize, maxSize int) *cdc {
+	b := bits.Len(uint(avgSize)) - 1 // log2(avgSize)
+	return &cdc{
+		minSize: minSize,
+		avgSize: avgSize,
+		maxSize: maxSize,
+		maskS:   ^uint64(0) << (64 - min(b+1, 64)),
+		maskL:   ^uint64(0) << (64 - max(b-1, 1)),
+	}
+}
+
+// cut returns the length of the next chunk at the start of buf.
+// The buffer must hold at least maxSize bytes, unless it holds the end of the input.
+func (c *cdc) cut(buf []byte) int {
+	n := len(buf)
+	if n <= c.minSize {
+		return n
+	}
+	n = min(n, c.maxSize)
+	normal := min(n, c.avgSize)
+
+	var h uint64
+	i := c.minSize
+	for ; i < normal; i++ {
+		h = (h << 1) + gear[buf[i]]
+		if h&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		h = (h << 1) + gear[buf[i]]
+		if h&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// gear holds the random values of the gear hash used by ContentDefinedChunks.
+// The values are generated by a fixed splitmix64 sequence; changing them would
+// change all chunk boundaries.
+var gear = func() (g [256]uint64) {
+	s := uint64(0x6a09e667f3bcc909)
+	for i := range g {
+		s += 0x9e3779b97f4a7c15
+		z := s
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		g[i] = z ^ (z >> 31)
+	}
+	return g
+}()
+
 // Keys returns the hashes of the chunks using the provided hash function
 func Keys(hashFunc func([]byte) uint64, chunks iter.Seq[[]byte]) []uint64 {
 	var keys []uint64
@@ -1,10 +1,15 @@
 package bbhash_test
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"iter"
+	"math/rand"
 	"slices"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/relab/bbhash"
@@ -28,6 +33,225 @@ func TestChunks(t *testing.T) {
 	}
 }
 
+func TestReadChunksReaders(t *testing.T) {
+	bufSz := 100
+	wantChunks := slices.Collect(slices.Chunk([]byte(input), bufSz))
+	tests := []struct {
+		name string
+		r    io.Reader
+	}{
+		{name: "OneByteReader", r: iotest.OneByteReader(strings.NewReader(input))},
+		{name: "HalfReader", r: iotest.HalfReader(strings.NewReader(input))},
+		{name: "DataErrReader", r: iotest.DataErrReader(strings.NewReader(input))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := slices.Collect(bbhash.ReadChunks(tt.r, bufSz, bbhash.OwnedBuffers()))
+			if diff := cmp.Diff(got, wantChunks); diff != "" {
+				t.Errorf("ReadChunks() (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReadChunksOwnedBuffers(t *testing.T) {
+	bufSz := 100
+	wantChunks := slices.Collect(slices.Chunk([]byte(input), bufSz))
+
+	// Without owned buffers, the chunks share a buffer that is overwritten
+	shared := slices.Collect(bbhash.ReadChunks(strings.NewReader(input), bufSz))
+	if len(shared) != len(wantChunks) {
+		t.Fatalf("ReadChunks() returned %d chunks, want %d", len(shared), len(wantChunks))
+	}
+	if &shared[0][0] != &shared[1][0] {
+		t.Error("ReadChunks() without OwnedBuffers should reuse its buffer")
+	}
+	owned := slices.Collect(bbhash.ReadChunks(strings.NewReader(input), bufSz, bbhash.OwnedBuffers()))
+	if diff := cmp.Diff(owned, wantChunks); diff != "" {
+		t.Errorf("ReadChunks(OwnedBuffers) (-got +want)\n%s", diff)
+	}
+}
+
+func TestFixedChunks(t *testing.T) {
+	var offset int64
+	for c, err := range bbhash.FixedChunks(strings.NewReader(input), 64) {
+		if err != nil {
+			t.Fatalf("FixedChunks() failed: %v", err)
+		}
+		if c.Offset != offset {
+			t.Errorf("chunk offset = %d, want %d", c.Offset, offset)
+		}
+		if want := input[offset : offset+int64(len(c.Data))]; string(c.Data) != want {
+			t.Errorf("chunk at %d = %q, want %q", offset, c.Data, want)
+		}
+		offset += int64(len(c.Data))
+	}
+	if offset != int64(len(input)) {
+		t.Errorf("FixedChunks() read %d bytes, want %d", offset, len(input))
+	}
+
+	// Read errors are yielded after the data read before the error
+	errRead := errors.New("read failed")
+	r := io.MultiReader(strings.NewReader(input[:100]), iotest.ErrReader(errRead))
+	var n int
+	var gotErr error
+	for c, err := range bbhash.FixedChunks(r, 64) {
+		n += len(c.Data)
+		gotErr = err
+	}
+	if n != 100 || gotErr != errRead {
+		t.Errorf("FixedChunks() = %d bytes, error %v; want 100 bytes, error %v", n, gotErr, errRead)
+	}
+}
+
+// collectChunks returns the chunks of data and checks that they cover data in order.
+func collectChunks(t *testing.T, r io.Reader, data []byte, minSize, avgSize, maxSize int) []bbhash.Chunk {
+	t.Helper()
+	var chunks []bbhash.Chunk
+	var offset int64
+	for c, err := range bbhash.ContentDefinedChunks(r, minSize, avgSize, maxSize, bbhash.OwnedBuffers()) {
+		if err != nil {
+			t.Fatalf("ContentDefinedChunks() failed: %v", err)
+		}
+		if c.Offset != offset {
+			t.Fatalf("chunk offset = %d, want %d", c.Offset, offset)
+		}
+		if !bytes.Equal(c.Data, data[offset:offset+int64(len(c.Data))]) {
+			t.Fatalf("chunk at %d does not match input", offset)
+		}
+		offset += int64(len(c.Data))
+		chunks = append(chunks, c)
+	}
+	if offset != int64(len(data)) {
+		t.Fatalf("ContentDefinedChunks() read %d bytes, want %d", offset, len(data))
+	}
+	return chunks
+}
+
+func TestContentDefinedChunks(t *testing.T) {
+	const minSize, avgSize, maxSize = 512, 2048, 8192
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(99)).Read(data)
+
+	chunks := collectChunks(t, bytes.NewReader(data), data, minSize, avgSize, maxSize)
+	for i, c := range chunks {
+		if n := len(c.Data); (n < minSize && i < len(chunks)-1) || n > maxSize {
+			t.Errorf("chunk %d has length %d, want in [%d, %d]", i, n, minSize, maxSize)
+		}
+	}
+	if avg := len(data) / len(chunks); avg < avgSize/2 || avg > 2*avgSize {
+		t.Errorf("average chunk length = %d, want about %d", avg, avgSize)
+	}
+
+	// Boundaries do not depend on how the reader returns data
+	oneByte := collectChunks(t, iotest.OneByteReader(bytes.NewReader(data)), data, minSize, avgSize, maxSize)
+	if len(oneByte) != len(chunks) {
+		t.Fatalf("OneByteReader: got %d chunks, want %d", len(oneByte), len(chunks))
+	}
+	for i := range chunks {
+		if oneByte[i].Offset != chunks[i].Offset {
+			t.Fatalf("OneByteReader: chunk %d at offset %d, want %d", i, oneByte[i].Offset, chunks[i].Offset)
+		}
+	}
+
+	// Inserting data only changes the chunks around the insertion
+	shifted := slices.Concat(data[:len(data)/2], []byte("inserted"), data[len(data)/2:])
+	seen := make(map[uint64]bool)
+	for _, c := range chunks {
+		seen[bbhash.FastHashFunc(c.Data)] = true
+	}
+	shiftedChunks := collectChunks(t, bytes.NewReader(shifted), shifted, minSize, avgSize, maxSize)
+	changed := 0
+	for _, c := range shiftedChunks {
+		if !seen[bbhash.FastHashFunc(c.Data)] {
+			changed++
+		}
+	}
+	if changed > 3 {
+		t.Errorf("inserting 8 bytes changed %d of %d chunks, want at most 3", changed, len(shiftedChunks))
+	}
+}
+
+// TestContentDefinedChunksStable pins the chunk boundaries for a fixed input,
+// since they must not change across releases.
+func TestContentDefinedChunksStable(t *testing.T) {
+	data := make([]byte, 1<<15)
+	rand.New(rand.NewSource(99)).Read(data)
+	want := []int64{
+		0, 1248, 2676, 4205, 5485, 6516, 7729, 9199, 9619, 10605, 11150, 12265, 13607, 15096,
+		16407, 17525, 18385, 20219, 22626, 23662, 24114, 25006, 25557, 27232, 28641, 29884, 30524, 32013,
+	}
+	var got []int64
+	for _, c := range collectChunks(t, bytes.NewReader(data), data, 256, 1024, 4096) {
+		got = append(got, c.Offset)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ContentDefinedChunks() offsets mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestContentDefinedChunksReadErrors(t *testing.T) {
+	data := make([]byte, 10_000)
+	rand.New(rand.NewSource(99)).Read(data)
+
+	// Read errors are yielded after the chunks of the data read before the error
+	errRead := errors.New("read failed")
+	r := io.MultiReader(bytes.NewReader(data), iotest.ErrReader(errRead))
+	var n int
+	var gotErr error
+	for c, err := range bbhash.ContentDefinedChunks(r, 256, 1024, 4096) {
+		if err != nil {
+			gotErr = err
+			continue
+		}
+		if c.Offset != int64(n) {
+			t.Fatalf("chunk offset = %d, want %d", c.Offset, n)
+		}
+		n += len(c.Data)
+	}
+	if n != len(data) || gotErr != errRead {
+		t.Errorf("ContentDefinedChunks() = %d bytes, error %v; want %d bytes, error %v", n, gotErr, len(data), errRead)
+	}
+
+	// A reader that makes no progress is reported instead of looping forever
+	n, gotErr = 0, nil
+	for c, err := range bbhash.ContentDefinedChunks(io.MultiReader(strings.NewReader(input), emptyReader{}), 16, 64, 256) {
+		n += len(c.Data)
+		gotErr = err
+	}
+	if n != len(input) || gotErr != io.ErrNoProgress {
+		t.Errorf("ContentDefinedChunks() = %d bytes, error %v; want %d bytes, error %v", n, gotErr, len(input), io.ErrNoProgress)
+	}
+}
+
+// emptyReader is a reader that never returns data or an error.
+type emptyReader struct{}
+
+func (emptyReader) Read([]byte) (int, error) { return 0, nil }
+
+func TestContentDefinedChunksInvalidSizes(t *testing.T) {
+	for _, sizes := range [][3]int{{0, 8, 16}, {16, 8, 32}, {4, 32, 16}, {1, 1, 1}} {
+		for _, err := range bbhash.ContentDefinedChunks(strings.NewReader(input), sizes[0], sizes[1], sizes[2]) {
+			if err == nil {
+				t.Errorf("ContentDefinedChunks(%v) should have failed", sizes)
+			}
+		}
+	}
+}
+
+func BenchmarkContentDefinedChunks(b *testing.B) {
+	data := make([]byte, 16<<20)
+	rand.New(rand.NewSource(99)).Read(data)
+	b.SetBytes(int64(len(data)))
+	for b.Loop() {
+		for _, err := range bbhash.ContentDefinedChunks(bytes.NewReader(data), 2048, 8192, 65536) {
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
 func CollectFunc[I, O any](seq iter.Seq[I], f func(I) O) (o []O) {
 	for v := range seq {
 		o = append(o, f(v))
@@ -0,0 +1,268 @@
+package bbhash
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// LazyBBHash2 is a read-only BBHash2 that decodes each partition from an
+// [io.ReaderAt] the first time a lookup is routed to it. This is useful when
+// only a fraction of the partitions of a large BBHash2 are ever queried.
+// A LazyBBHash2 is safe for concurrent use.
+type LazyBBHash2 struct {
+	r           io.ReaderAt
+	size        int64 // length of the data in r, or -1 if unknown
+	idx         *partitionIndex
+	slots       []lazyPartition
+	maxResident int
+
+	mu       sync.Mutex // guards resident and the stores to the slots' bb pointers
+	resident int
+	clock    atomic.Uint64 // logical clock used to track the last use of each partition
+}
+
+// lazyPartition holds a partition that may or may not have been decoded yet.
+type lazyPartition struct {
+	load    sync.Mutex // serializes decoding of this partition
+	bb      atomic.Pointer[BBHash]
+	lastUse atomic.Uint64
+}
+
+type lazyOptions struct {
+	maxResident int
+}
+
+// LazyOptions are options for opening a LazyBBHash2 with OpenLazy.
+type LazyOptions func(*lazyOptions)
+
+// MaxResident limits the number of decoded partitions held in memory by a LazyBBHash2.
+// When the limit is exceeded, the least recently used partition is evicted and
+// decoded again the next time a lookup is routed to it. The default is no limit.
+func MaxResident(partitions int) LazyOptions {
+	return func(o *lazyOptions) {
+		o.maxResident = max(partitions, 0)
+	}
+}
+
+// OpenLazy returns a LazyBBHash2 reading from r, which must hold a BBHash2
+// encoded with AppendIndexed. Only the partition index is read by OpenLazy.
+// Before allocating memory for a partition, Load checks that its data exists;
+// see checkExtent.
+func OpenLazy(r io.ReaderAt, opts ...LazyOptions) (*LazyBBHash2, error) {
+	o := &lazyOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	header := make([]byte, indexedHeaderLength)
+	if err := readAt(r, header, 0); err != nil {
+		return nil, fmt.Errorf("bbhash.OpenLazy: reading header: %w", err)
+	}
+	idxLen, err := indexLength(header)
+	if err != nil {
+		return nil, fmt.Errorf("bbhash.OpenLazy: %w", err)
+	}
+	buf := make([]byte, idxLen)
+	if err := readAt(r, buf, 0); err != nil {
+		return nil, fmt.Errorf("bbhash.OpenLazy: reading partition index: %w", err)
+	}
+	idx, err := decodeIndex(buf, math.MaxInt64)
+	if err != nil {
+		return nil, fmt.Errorf("bbhash.OpenLazy: %w", err)
+	}
+	return &LazyBBHash2{
+		r:           r,
+		size:        readerSize(r),
+		idx:         idx,
+		slots:       make([]lazyPartition, len(idx.offsets)),
+		maxResident: o.maxResident,
+	}, nil
+}
+
+// Find returns a unique index representing the key in the minimal hash set.
+// See BBHash2.Find for the semantics of the return value.
+//
+// Find returns 0 if the partition that the key is routed to cannot be decoded.
+// Use Load or Preload to observe decoding errors.
+func (lb *LazyBBHash2) Find(key uint64) uint64 {
+	i := key % uint64(len(lb.slots))
+	bb, err := lb.Load(int(i))
+	if err != nil {
+		return 0
+	}
+	index := bb.Find(key)
+	if index == 0 {
+		return 0
+	}
+	return index + uint64(lb.idx.offsets[i])
+}
+
+// Lookup returns the index of the key in the range [1, len(keys)] and true,
+// or 0 and false if the key is not found; see BBHash2.Lookup.
+// Lookup reports false if the partition that the key is routed to cannot be decoded.
+func (lb *LazyBBHash2) Lookup(key uint64) (uint64, bool) {
+	index := lb.Find(key)
+	return index, index != 0
+}
+
+// Index is like Lookup, but returns a 0-based index in the range [0, len(keys)),
+// or 0 and false if the key is not found.
+func (lb *LazyBBHash2) Index(key uint64) (uint64, bool) {
+	index := lb.Find(key)
+	if index == 0 {
+		return 0, false
+	}
+	return index - 1, true
+}
+
+// Load returns partition i, decoding it if it is not already resident.
+func (lb *LazyBBHash2) Load(i int) (*BBHash, error) {
+	if i < 0 || i >= len(lb.slots) {
+		return nil, fmt.Errorf("LazyBBHash2.Load: partition %d out of range [0, %d)", i, len(lb.slots))
+	}
+	slot := &lb.slots[i]
+	if bb := slot.bb.Load(); bb != nil {
+		lb.touch(slot)
+		return bb, nil
+	}
+
+	slot.load.Lock()
+	defer slot.load.Unlock()
+	// another goroutine may have decoded the partition while we waited
+	if bb := slot.bb.Load(); bb != nil {
+		lb.touch(slot)
+		return bb, nil
+	}
+
+	start, length := int64(lb.idx.starts[i]), int64(lb.idx.lengths[i])
+	if err := checkExtent(lb.r, lb.size, start, length); err != nil {
+		return nil, fmt.Errorf("LazyBBHash2.Load: partition %d: %w", i, err)
+	}
+	buf := make([]byte, length)
+	if err := readAt(lb.r, buf, start); err != nil {
+		return nil, fmt.Errorf("LazyBBHash2.Load: reading partition %d: %w", i, err)
+	}
+	bb := &BBHash{}
+	if err := bb.unmarshalPartition(buf, lb.idx.flags); err != nil {
+		return nil, fmt.Errorf("LazyBBHash2.Load: partition %d: %w", i, err)
+	}
+
+	lb.touch(slot)
+	lb.mu.Lock()
+	slot.bb.Store(bb)
+	lb.resident++
+	if lb.maxResident > 0 && lb.resident > lb.maxResident {
+		lb.evict(i)
+	}
+	lb.mu.Unlock()
+	return bb, nil
+}
+
+// Preload decodes all partitions that are not already resident.
+// If MaxResident is set, partitions may be evicted again while preloading.
+func (lb *LazyBBHash2) Preload() error {
+	for i := range lb.slots {
+		if _, err := lb.Load(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// touch records the use of the given partition; only needed when eviction is enabled.
+func (lb *LazyBBHash2) touch(slot *lazyPartition) {
+	if lb.maxResident > 0 {
+		slot.lastUse.Store(lb.clock.Add(1))
+	}
+}
+
+// evict drops the least recently used resident partition other than keep.
+// Lookups that already hold the evicted partition are unaffected.
+// The caller must hold lb.mu.
+func (lb *LazyBBHash2) evict(keep int) {
+	victim := -1
+	var oldest uint64
+	for j := range lb.slots {
+		if j == keep || lb.slots[j].bb.Load() == nil {
+			continue
+		}
+		if lastUse := lb.slots[j].lastUse.Load(); victim < 0 || lastUse < oldest {
+			victim, oldest = j, lastUse
+		}
+	}
+	if victim >= 0 {
+		lb.slots[victim].bb.Store(nil)
+		lb.resident--
+	}
+}
+
+// Partitions returns the number of partitions in the LazyBBHash2.
+func (lb *LazyBBHash2) Partitions() int {
+	return len(lb.slots)
+}
+
+// Resident returns the number of partitions currently decoded and held in memory.
+func (lb *LazyBBHash2) Resident() int {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.resident
+}
+
+// readerSize returns the length of the data in r, if r has a Size method, such as
+// [io.SectionReader] and [bytes.Reader], or a Stat method, such as [os.File].
+// It returns -1 if the length is unknown.
+func readerSize(r io.ReaderAt) int64 {
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size()
+	case interface{ Stat() (os.FileInfo, error) }:
+		if fi, err := r.Stat(); err == nil && fi.Mode().IsRegular() {
+			return fi.Size()
+		}
+	}
+	return -1
+}
+
+// checkExtent checks that r holds length bytes at offset start, where size is the
+// length of the data in r, or -1 if unknown. If the size is unknown, it reads the
+// last byte of the extent. This allows corrupt lengths to be reported as errors,
+// instead of allocating buffers for data that does not exist.
+func checkExtent(r io.ReaderAt, size, start, length int64) error {
+	if start < 0 || length < 0 || start > math.MaxInt64-length {
+		return fmt.Errorf("invalid length %d at offset %d", length, start)
+	}
+	if size >= 0 {
+		if start+length > size {
+			return fmt.Errorf("length %d at offset %d exceeds data length %d", length, start, size)
+		}
+		return nil
+	}
+	if length == 0 {
+		return nil
+	}
+	if err := readAt(r, make([]byte, 1), start+length-1); err != nil {
+		return fmt.Errorf("length %d at offset %d exceeds data: %w", length, start, err)
+	}
+	return nil
+}
+
+// readAt reads exactly len(buf) bytes from r at offset off.
+func readAt(r io.ReaderAt, buf []byte, off int64) error {
+	n, err := r.ReadAt(buf, off)
+	if n == len(buf) {
+		// ReadAt may return io.EOF along with the last bytes of the input
+		return nil
+	}
+	if err == nil || errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// enforce interface compliance
+var _ bbhash = (*LazyBBHash2)(nil)
@@ -0,0 +1,166 @@
+package bbhash_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/relab/bbhash"
+	"github.com/relab/bbhash/internal/test"
+)
+
+func TestOpenLazy(t *testing.T) {
+	testCases := []struct {
+		size        int
+		partitions  int
+		maxResident int
+	}{
+		{size: 100, partitions: 1},
+		{size: 1000, partitions: 4},
+		{size: 10000, partitions: 8},
+		{size: 10000, partitions: 8, maxResident: 1},
+		{size: 100000, partitions: 16, maxResident: 3},
+	}
+	for _, tc := range testCases {
+		t.Run(test.Name("", []string{"keys", "partitions", "maxResident"}, tc.size, tc.partitions, tc.maxResident), func(t *testing.T) {
+			keys := generateKeys(tc.size, 98)
+			bb, err := bbhash.New(keys, bbhash.Partitions(tc.partitions))
+			if err != nil {
+				t.Fatalf("Failed to create BBHash2: %v", err)
+			}
+			data, err := bb.MarshalIndexed()
+			if err != nil {
+				t.Fatalf("Failed to marshal BBHash2: %v", err)
+			}
+
+			lb, err := bbhash.OpenLazy(bytes.NewReader(data), bbhash.MaxResident(tc.maxResident))
+			if err != nil {
+				t.Fatalf("Failed to open LazyBBHash2: %v", err)
+			}
+			if lb.Partitions() != bb.Partitions() {
+				t.Errorf("lb.Partitions() = %d, want %d", lb.Partitions(), bb.Partitions())
+			}
+			if lb.Resident() != 0 {
+				t.Errorf("lb.Resident() = %d, want 0", lb.Resident())
+			}
+
+			// Query the keys concurrently to exercise concurrent loading and eviction
+			var wg sync.WaitGroup
+			for w := range 4 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := w; i < len(keys); i += 4 {
+						if got, want := lb.Find(keys[i]), bb.Find(keys[i]); got != want {
+							t.Errorf("lb.Find(%d) = %d, want %d", keys[i], got, want)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			for _, k := range generateKeys(1000, 99) {
+				if got, want := lb.Find(k), bb.Find(k); got != want {
+					t.Errorf("lb.Find(%d) = %d, want %d", k, got, want)
+				}
+				if got, ok := lb.Lookup(k); ok != (got != 0) {
+					t.Errorf("lb.Lookup(%d) = %d, %t", k, got, ok)
+				}
+				if got, ok := lb.Index(k); ok != (bb.Find(k) != 0) || (!ok && got != 0) {
+					t.Errorf("lb.Index(%d) = %d, %t", k, got, ok)
+				}
+			}
+
+			wantResident := bb.Partitions()
+			if tc.maxResident > 0 {
+				wantResident = min(tc.maxResident, wantResident)
+			}
+			if lb.Resident() != wantResident {
+				t.Errorf("lb.Resident() = %d, want %d", lb.Resident(), wantResident)
+			}
+		})
+	}
+}
+
+func TestOpenLazyErrors(t *testing.T) {
+	keys := generateKeys(10000, 98)
+	bb, err := bbhash.New(keys, bbhash.Partitions(4))
+	if err != nil {
+		t.Fatalf("Failed to create BBHash2: %v", err)
+	}
+	legacy, _ := bb.MarshalBinary()
+	if _, err := bbhash.OpenLazy(bytes.NewReader(legacy)); err == nil {
+		t.Error("OpenLazy() should have failed for the default encoding")
+	}
+
+	data, _ := bb.MarshalIndexed()
+	if _, err := bbhash.OpenLazy(bytes.NewReader(data[:10])); err == nil {
+		t.Error("OpenLazy() should have failed for a truncated partition index")
+	}
+
+	// A truncated partition is only detected when the partition is loaded
+	lb, err := bbhash.OpenLazy(bytes.NewReader(data[:len(data)-1]))
+	if err != nil {
+		t.Fatalf("Failed to open LazyBBHash2: %v", err)
+	}
+	if err := lb.Preload(); err == nil {
+		t.Error("Preload() should have failed for a truncated partition")
+	}
+	if _, err := lb.Load(lb.Partitions()); err == nil {
+		t.Error("Load() should have failed for an out of range partition")
+	}
+}
+
+// readerAt hides the Size method of the underlying reader.
+type readerAt struct{ r io.ReaderAt }
+
+func (r readerAt) ReadAt(p []byte, off int64) (int, error) { return r.r.ReadAt(p, off) }
+
+func TestOpenLazyCorruptLength(t *testing.T) {
+	bb, err := bbhash.New(generateKeys(10000, 98), bbhash.Partitions(4))
+	if err != nil {
+		t.Fatalf("Failed to create BBHash2: %v", err)
+	}
+	data, _ := bb.MarshalIndexed()
+	// the length of partition 0 follows the 4-byte header and its 4-byte key offset
+	binary.LittleEndian.PutUint64(data[8:], 1<<62)
+
+	for _, r := range []io.ReaderAt{bytes.NewReader(data), readerAt{bytes.NewReader(data)}} {
+		lb, err := bbhash.OpenLazy(r)
+		if err != nil {
+			t.Fatalf("Failed to open LazyBBHash2: %v", err)
+		}
+		if _, err := lb.Load(0); err == nil {
+			t.Errorf("Load(0) should have failed for a corrupt partition length (%T)", r)
+		}
+	}
+	if err := (&bbhash.BBHash2{}).UnmarshalBinary(data); err == nil {
+		t.Error("UnmarshalBinary() should have failed for a corrupt partition length")
+	}
+}
+
+func BenchmarkLazyFind(b *testing.B) {
+	for _, size := range keySizes {
+		keys := generateKeys(size, 99)
+		for _, partitions := range partitionValues {
+			b.Run(test.Name("", []string{"partitions", "keys"}, partitions, size), func(b *testing.B) {
+				bb, _ := bbhash.New(keys, bbhash.Partitions(partitions))
+				data, _ := bb.MarshalIndexed()
+				lb, err := bbhash.OpenLazy(bytes.NewReader(data))
+				if err != nil {
+					b.Fatal(err)
+				}
+				for b.Loop() {
+					for _, k := range keys {
+						if lb.Find(k) == 0 {
+							b.Fatalf("can't find the key: %#x", k)
+						}
+					}
+				}
+			})
+		}
+	}
+}
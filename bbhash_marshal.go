@@ -4,6 +4,10 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"runtime"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
 )
 
 // marshalLength returns the number of bytes needed to marshal the BBHash.
@@ -21,6 +25,9 @@ func (bb BBHash) AppendBinary(buf []byte) (_ []byte, err error) {
 	if numBitVectors == 0 {
 		return nil, errors.New("BBHash.AppendBinary: no data")
 	}
+	if bb.cpp != nil {
+		return nil, errors.New("BBHash.AppendBinary: created with CompatibleHash; use AppendCPP")
+	}
 	// append header: the number of bit vectors (levels)
 	buf = append(buf, numBitVectors)
 
@@ -34,7 +41,8 @@ func (bb BBHash) AppendBinary(buf []byte) (_ []byte, err error) {
 
 	// We don't append the rank vector, since we can re-compute it
 	// when we unmarshal the bit vectors.
-	// Similarly, the reverse map it is not meant to be serialized.
+	// Similarly, the reverse map is not serialized here; it is only
+	// included in BBHash2's indexed encoding (see AppendIndexed).
 
 	return buf, nil
 }
@@ -122,49 +130,323 @@ func (b2 BBHash2) MarshalBinary() ([]byte, error) {
 }
 
 // UnmarshalBinary implements the [encoding.BinaryUnmarshaler] interface.
+// The data may use either the default encoding or the indexed encoding produced by AppendIndexed.
+// The partitions are located first and then decoded concurrently.
 func (b2 *BBHash2) UnmarshalBinary(data []byte) error {
-	// Make a copy of data, since we will be modifying buf's slice indices
-	buf := data
-	if len(buf) < 1 {
+	if len(data) < 1 {
 		return errors.New("BBHash2.UnmarshalBinary: no data")
 	}
 
+	var idx *partitionIndex
+	var err error
+	if data[0] == indexedMarker {
+		idx, err = decodeIndex(data, uint64(len(data)))
+	} else {
+		idx, err = scanIndex(data)
+	}
+	if err != nil {
+		return fmt.Errorf("BBHash2.UnmarshalBinary: %w", err)
+	}
+	if uint64(len(data)) < idx.end() {
+		return errors.New("BBHash2.UnmarshalBinary: insufficient data for remaining partitions")
+	}
+
+	// Decode (and rank) the partitions on a bounded pool of workers;
+	// each worker picks the next partition that has not yet been claimed.
+	partitions := make([]BBHash, len(idx.offsets))
+	workers := min(runtime.GOMAXPROCS(0), len(partitions))
+	var next atomic.Int64
+	grp := &errgroup.Group{}
+	for range workers {
+		grp.Go(func() error {
+			for i := next.Add(1) - 1; i < int64(len(partitions)); i = next.Add(1) - 1 {
+				start, end := idx.starts[i], idx.starts[i]+idx.lengths[i]
+				if err := partitions[i].unmarshalPartition(data[start:end], idx.flags); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err := grp.Wait(); err != nil {
+		return err
+	}
+
+	*b2 = BBHash2{ // modify b2 in place
+		partitions: partitions,
+		offsets:    idx.offsets,
+	}
+	return nil
+}
+
+// scanIndex locates the partitions in the default BBHash2 encoding by scanning
+// the level headers of each partition, without decoding the bit vectors.
+func scanIndex(data []byte) (*partitionIndex, error) {
 	// Read header: the number of partitions
-	numPartitions := uint8(buf[0])
+	numPartitions := int(data[0])
 	if numPartitions == 0 || numPartitions > maxPartitions {
-		return fmt.Errorf("BBHash2.UnmarshalBinary: invalid number of partitions %d (max %d)", numPartitions, maxPartitions)
+		return nil, fmt.Errorf("invalid number of partitions %d (max %d)", numPartitions, maxPartitions)
 	}
-	buf = buf[1:] // move past header
-
-	*b2 = BBHash2{} // modify b2 in place
-	b2.partitions = make([]BBHash, numPartitions)
 
-	// Read BBHash for each partition
+	idx := &partitionIndex{
+		offsets: make([]uint32, numPartitions),
+		starts:  make([]uint64, numPartitions),
+		lengths: make([]uint64, numPartitions),
+	}
+	start := uint64(1) // move past header
 	for i := range numPartitions {
-		bb := BBHash{}
-		if err := bb.UnmarshalBinary(buf); err != nil {
-			return err
-		}
-		b2.partitions[i] = bb
-		bbLen := bb.marshaledLength()
-		if len(buf) < bbLen {
-			return errors.New("BBHash2.UnmarshalBinary: insufficient data for remaining partitions")
+		bbLen, err := scanPartition(data[start:])
+		if err != nil {
+			return nil, err
 		}
-		buf = buf[bbLen:] // move past the current partition
+		idx.starts[i] = start
+		idx.lengths[i] = bbLen
+		start += bbLen // move past the current partition
 	}
 
 	// we skip the first offset since it is always 0, hence numPartitions-1
-	if len(buf) < int(uint32bytes*(numPartitions-1)) {
-		return errors.New("BBHash2.UnmarshalBinary: insufficient data for offset vector")
+	buf := data[start:]
+	if len(buf) < uint32bytes*(numPartitions-1) {
+		return nil, errors.New("insufficient data for offset vector")
 	}
 
 	// Read offset vector
-	b2.offsets = make([]uint32, numPartitions)
-	b2.offsets[0] = 0 // first offset is always 0
-	for i := uint8(1); i < numPartitions; i++ {
-		b2.offsets[i] = binary.LittleEndian.Uint32(buf[:uint32bytes])
+	for i := 1; i < numPartitions; i++ {
+		idx.offsets[i] = binary.LittleEndian.Uint32(buf[:uint32bytes])
 		buf = buf[uint32bytes:] // move past the current offset
 	}
+	return idx, nil
+}
+
+// scanPartition returns the length of the BBHash encoding at the start of buf.
+func scanPartition(buf []byte) (uint64, error) {
+	if len(buf) < 1 {
+		return 0, errors.New("insufficient data for remaining partitions")
+	}
+	numBitVectors := int(buf[0])
+	if numBitVectors == 0 || numBitVectors > maxLevel {
+		return 0, fmt.Errorf("invalid number of bit vectors %d (max %d)", numBitVectors, maxLevel)
+	}
+
+	bbLen := uint64(1) // move past header
+	for range numBitVectors {
+		if uint64(len(buf)) < bbLen+uint32bytes {
+			return 0, errors.New("insufficient data for remaining bit vectors")
+		}
+		words := uint64(binary.LittleEndian.Uint32(buf[bbLen:]))
+		bbLen += uint32bytes + uint64bytes*words // move past the current bit vector
+		if uint64(len(buf)) < bbLen {
+			return 0, errors.New("insufficient data for remaining bit vectors")
+		}
+	}
+	return bbLen, nil
+}
+
+const (
+	// indexedMarker is the first byte of the indexed BBHash2 encoding.
+	// The legacy encoding starts with the number of partitions, which is never 0.
+	indexedMarker = 0x00
+
+	// indexedVersion is the version of the indexed BBHash2 encoding.
+	indexedVersion = 2
+
+	// indexedHeaderLength is the length of the indexed header: marker, version, number of partitions and flags.
+	indexedHeaderLength = 4
+
+	// flagReverseMap is set in the indexed header if each partition's encoding
+	// is followed by its reverse map, i.e., the keys in index order.
+	flagReverseMap = 1 << 0
+
+	// flagCompressedReverseMap is set in the indexed header, in addition to flagReverseMap,
+	// if each partition's reverse map is compressed; see WithCompressedReverseMap.
+	flagCompressedReverseMap = 1 << 1
+
+	// indexEntryLength is the length of a partition index entry: key offset and encoded length.
+	indexEntryLength = uint32bytes + uint64bytes
+)
+
+// indexedLength returns the number of bytes needed to marshal the BBHash2 using the indexed encoding.
+func (b2 BBHash2) indexedLength() int {
+	flags := b2.indexedFlags()
+	b2Len := indexedHeaderLength + indexEntryLength*len(b2.partitions)
+	for _, bb := range b2.partitions {
+		b2Len += bb.indexedLength(flags)
+	}
+	return b2Len
+}
+
+// indexedFlags returns the flags of the indexed encoding of the BBHash2.
+// The reverse map is stored compressed only if all partitions have a compressed reverse map.
+func (b2 BBHash2) indexedFlags() uint8 {
+	switch {
+	case b2.compressedReverseMap():
+		return flagReverseMap | flagCompressedReverseMap
+	case b2.HasReverseMap():
+		return flagReverseMap
+	}
+	return 0
+}
+
+// indexedLength returns the number of bytes needed to marshal the BBHash as a
+// partition of the indexed encoding, followed by its reverse map if the flags say so.
+func (bb BBHash) indexedLength(flags uint8) int {
+	switch {
+	case flags&flagCompressedReverseMap != 0:
+		return bb.marshaledLength() + bb.compressed.marshaledLength()
+	case flags&flagReverseMap != 0:
+		return bb.marshaledLength() + uint64bytes*int(bb.entries())
+	}
+	return bb.marshaledLength()
+}
+
+// AppendIndexed appends the indexed encoding of the BBHash2 to buf.
+// The indexed encoding starts with a partition index holding the key offset
+// and the encoded length of each partition, which allows a partition to be
+// located and decoded without decoding the partitions before it; see OpenLazy.
+// If the BBHash2 was created with a reverse map, the reverse map is included
+// in the indexed encoding, compressed if it was created with WithCompressedReverseMap.
+// UnmarshalBinary accepts both the indexed and the default encoding.
+func (b2 BBHash2) AppendIndexed(buf []byte) (_ []byte, err error) {
+	numPartitions := uint8(len(b2.partitions))
+	if numPartitions == 0 {
+		return nil, errors.New("BBHash2.AppendIndexed: no data")
+	}
+	flags := b2.indexedFlags()
+	// append header: marker, version, the number of partitions and flags
+	buf = append(buf, indexedMarker, indexedVersion, numPartitions, flags)
+
+	// append the partition index: key offset and encoded length of each partition
+	for i, bb := range b2.partitions {
+		buf = binary.LittleEndian.AppendUint32(buf, b2.offsets[i])
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(bb.indexedLength(flags)))
+	}
+
+	// append the BBHash for each partition, followed by its reverse map if present
+	for _, bb := range b2.partitions {
+		buf, err = bb.AppendBinary(buf)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case flags&flagCompressedReverseMap != 0:
+			buf = bb.compressed.appendBinary(buf)
+		case flags&flagReverseMap != 0:
+			for index := range bb.entries() {
+				key, _ := bb.LookupKey(index + 1)
+				buf = binary.LittleEndian.AppendUint64(buf, key)
+			}
+		}
+	}
+	return buf, nil
+}
+
+// MarshalIndexed returns the indexed encoding of the BBHash2; see AppendIndexed.
+func (b2 BBHash2) MarshalIndexed() ([]byte, error) {
+	return b2.AppendIndexed(make([]byte, 0, b2.indexedLength()))
+}
+
+// partitionIndex holds the location of each partition in the indexed encoding.
+type partitionIndex struct {
+	offsets []uint32 // key offset of each partition
+	starts  []uint64 // start of each partition's encoding, relative to the start of the encoding
+	lengths []uint64 // length of each partition's encoding
+	flags   uint8    // flags of the indexed header; describes the reverse map following each partition
+}
+
+// indexLength returns the length of the header and partition index of the indexed
+// encoding, given the header. It returns an error if the header is invalid.
+func indexLength(header []byte) (int, error) {
+	if len(header) < indexedHeaderLength || header[0] != indexedMarker {
+		return 0, errors.New("not an indexed encoding")
+	}
+	if version := header[1]; version != indexedVersion {
+		return 0, fmt.Errorf("unsupported indexed encoding version %d (want %d)", version, indexedVersion)
+	}
+	numPartitions := int(header[2])
+	if numPartitions == 0 || numPartitions > maxPartitions {
+		return 0, fmt.Errorf("invalid number of partitions %d (max %d)", numPartitions, maxPartitions)
+	}
+	flags := header[3]
+	if flags&^(flagReverseMap|flagCompressedReverseMap) != 0 || flags == flagCompressedReverseMap {
+		return 0, fmt.Errorf("unsupported indexed encoding flags %#02x", flags)
+	}
+	return indexedHeaderLength + indexEntryLength*numPartitions, nil
+}
 
+// decodeIndex decodes the header and partition index at the start of buf.
+// It returns an error if a partition extends beyond size, the length of the encoding.
+func decodeIndex(buf []byte, size uint64) (*partitionIndex, error) {
+	idxLen, err := indexLength(buf)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < idxLen {
+		return nil, errors.New("insufficient data for partition index")
+	}
+	numPartitions := int(buf[2])
+	flags := buf[3]
+	buf = buf[indexedHeaderLength:idxLen] // move past header
+
+	idx := &partitionIndex{
+		offsets: make([]uint32, numPartitions),
+		starts:  make([]uint64, numPartitions),
+		lengths: make([]uint64, numPartitions),
+		flags:   flags,
+	}
+	start := uint64(idxLen)
+	for i := range numPartitions {
+		idx.offsets[i] = binary.LittleEndian.Uint32(buf[:uint32bytes])
+		idx.lengths[i] = binary.LittleEndian.Uint64(buf[uint32bytes:indexEntryLength])
+		idx.starts[i] = start
+		if idx.lengths[i] == 0 || start+idx.lengths[i] < start {
+			return nil, fmt.Errorf("invalid length %d for partition %d", idx.lengths[i], i)
+		}
+		if start+idx.lengths[i] > size {
+			return nil, fmt.Errorf("partition %d of length %d exceeds encoding length %d", i, idx.lengths[i], size)
+		}
+		start += idx.lengths[i]
+		buf = buf[indexEntryLength:] // move past the current index entry
+	}
+	return idx, nil
+}
+
+// end returns the end of the last partition's encoding.
+func (idx *partitionIndex) end() uint64 {
+	last := len(idx.starts) - 1
+	return idx.starts[last] + idx.lengths[last]
+}
+
+// unmarshalPartition decodes a BBHash from data, which must hold exactly one
+// encoded BBHash, followed by its reverse map if the indexed encoding flags say so.
+func (bb *BBHash) unmarshalPartition(data []byte, flags uint8) error {
+	if err := bb.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	buf := data[bb.marshaledLength():] // move past the bit vectors
+	switch {
+	case flags&flagCompressedReverseMap != 0:
+		m, err := unmarshalCompressedMap(buf, bb.entries())
+		if err != nil {
+			return fmt.Errorf("BBHash.UnmarshalBinary: %w", err)
+		}
+		bb.compressed = m
+		return nil
+	case flags&flagReverseMap == 0:
+		if len(buf) != 0 {
+			return fmt.Errorf("BBHash.UnmarshalBinary: encoded length %d does not match partition length %d", bb.marshaledLength(), len(data))
+		}
+		return nil
+	}
+
+	// Read the reverse map: the keys in index order
+	entries := bb.entries()
+	if uint64(len(buf)) != entries*uint64bytes {
+		return fmt.Errorf("BBHash.UnmarshalBinary: reverse map length %d does not match %d entries", len(buf), entries)
+	}
+	bb.reverseMap = make([]uint64, entries+1)
+	for i := range entries {
+		bb.reverseMap[i+1] = binary.LittleEndian.Uint64(buf[:uint64bytes])
+		buf = buf[uint64bytes:]
+	}
 	return nil
 }
@@ -110,6 +110,99 @@ func TestMarshalUnmarshalBBHash2(t *testing.T) {
 	}
 }
 
+func TestUnmarshalBBHash2Truncated(t *testing.T) {
+	keys := generateKeys(10000, 98)
+	bb, err := bbhash.New(keys, bbhash.Partitions(8))
+	if err != nil {
+		t.Fatalf("Failed to create BBHash2: %v", err)
+	}
+	data, err := bb.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to marshal BBHash2: %v", err)
+	}
+	newBB := &bbhash.BBHash2{}
+	for _, n := range []int{1, 2, 10, len(data) / 2, len(data) - 1} {
+		if err = newBB.UnmarshalBinary(data[:n]); err == nil {
+			t.Errorf("UnmarshalBinary(data[:%d]) should have failed", n)
+		}
+	}
+}
+
+func TestMarshalUnmarshalBBHash2Indexed(t *testing.T) {
+	testCases := []struct {
+		size       int
+		partitions int
+	}{
+		{size: 100, partitions: 1},
+		{size: 1000, partitions: 4},
+		{size: 100000, partitions: 16},
+	}
+
+	for _, tc := range testCases {
+		t.Run(test.Name("", []string{"keys", "partitions"}, tc.size, tc.partitions), func(t *testing.T) {
+			keys := generateKeys(tc.size, 98)
+
+			bb, err := bbhash.New(keys, bbhash.Partitions(tc.partitions))
+			if err != nil {
+				t.Fatalf("Failed to create BBHash2: %v", err)
+			}
+			data, err := bb.MarshalIndexed()
+			if err != nil {
+				t.Fatalf("Failed to marshal BBHash2: %v", err)
+			}
+
+			newBB := &bbhash.BBHash2{}
+			if err = newBB.UnmarshalBinary(data); err != nil {
+				t.Fatalf("Failed to unmarshal BBHash2: %v", err)
+			}
+			for _, key := range keys {
+				if got, want := newBB.Find(key), bb.Find(key); got != want {
+					t.Fatalf("newBB.Find(%d) = %d, want %d", key, got, want)
+				}
+			}
+
+			// Truncated data must be rejected
+			for _, n := range []int{1, 3, 10, len(data) - 1} {
+				if err = newBB.UnmarshalBinary(data[:n]); err == nil {
+					t.Errorf("UnmarshalBinary(data[:%d]) should have failed", n)
+				}
+			}
+		})
+	}
+}
+
+func TestMarshalUnmarshalBBHash2IndexedReverseMap(t *testing.T) {
+	for _, partitions := range []int{1, 4, 16} {
+		t.Run(test.Name("", []string{"partitions"}, partitions), func(t *testing.T) {
+			keys := generateKeys(10000, 98)
+			bb, err := bbhash.New(keys, bbhash.Partitions(partitions), bbhash.WithReverseMap())
+			if err != nil {
+				t.Fatalf("Failed to create BBHash2: %v", err)
+			}
+			data, err := bb.MarshalIndexed()
+			if err != nil {
+				t.Fatalf("Failed to marshal BBHash2: %v", err)
+			}
+			newBB := &bbhash.BBHash2{}
+			if err = newBB.UnmarshalBinary(data); err != nil {
+				t.Fatalf("Failed to unmarshal BBHash2: %v", err)
+			}
+			for _, key := range keys {
+				index := newBB.Find(key)
+				if want := bb.Find(key); index != want {
+					t.Fatalf("newBB.Find(%d) = %d, want %d", key, index, want)
+				}
+				if got := newBB.Key(index); got != key {
+					t.Fatalf("newBB.Key(%d) = %d, want %d", index, got, key)
+				}
+			}
+			if err = newBB.UnmarshalBinary(data[:len(data)-1]); err == nil {
+				t.Error("UnmarshalBinary() should have failed for a truncated reverse map")
+			}
+		})
+	}
+}
+
 // Run with:
 // go test -run x -bench BenchmarkBBHashMarshalBinary -benchmem
 func BenchmarkBBHashMarshalBinary(b *testing.B) {
@@ -20,11 +20,13 @@ const (
 )
 
 type options struct {
-	gamma         float64
-	initialLevels int
-	partitions    int
-	parallel      bool
-	reverseMap    bool
+	gamma              float64
+	initialLevels      int
+	partitions         int
+	parallel           bool
+	reverseMap         bool
+	compressReverseMap bool
+	compatibleHash     bool
 }
 
 func newOptions(opts ...Options) *options {
@@ -82,3 +84,27 @@ func WithReverseMap() Options {
 		o.reverseMap = true
 	}
 }
+
+// WithCompressedReverseMap creates a compressed reverse map when creating a BBHash.
+// The keys are stored in sorted order using the Elias-Fano encoding, along with a
+// packed permutation from index to sorted position. This uses much less space than
+// the 64 bits per key of WithReverseMap when the keys are clustered, such as dense
+// or sequential IDs, but Key and LookupKey are slower. For random 64-bit keys, it
+// uses slightly more space. The option implies WithReverseMap.
+func WithCompressedReverseMap() Options {
+	return func(o *options) {
+		o.reverseMap = true
+		o.compressReverseMap = true
+	}
+}
+
+// CompatibleHash creates a BBHash with the hash functions, level sizes and last-level
+// map of the reference C++ implementation, so that it can be exported with MarshalCPP
+// and queried by the C++ implementation. Such a BBHash can only be encoded with
+// MarshalCPP. This option is not compatible with the Partitions and Parallel options,
+// and InitialLevels has no effect, since the C++ implementation always uses 25 levels.
+func CompatibleHash() Options {
+	return func(o *options) {
+		o.compatibleHash = true
+	}
+}
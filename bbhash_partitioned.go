@@ -1,6 +1,9 @@
 package bbhash
 
 import (
+	"iter"
+	"sort"
+
 	"golang.org/x/sync/errgroup"
 )
 
@@ -13,7 +16,8 @@ type BBHash2 struct {
 // New creates a new BBHash2 for the given keys. The keys must be unique.
 // Creation is configured using the provided options. The default options
 // are used if none are provided. Available options include: Gamma,
-// InitialLevels, Partitions, Parallel, and WithReverseMap.
+// InitialLevels, Partitions, Parallel, WithReverseMap, WithCompressedReverseMap,
+// and CompatibleHash.
 // With fewer than 1000 keys, the sequential version is always used.
 func New(keys []uint64, opts ...Options) (*BBHash2, error) {
 	if len(keys) < 1 {
@@ -24,10 +28,17 @@ func New(keys []uint64, opts ...Options) (*BBHash2, error) {
 	if o.partitions > 1 && o.parallel {
 		panic("bbhash: parallel and partitions not supported")
 	}
+	if o.compatibleHash && (o.partitions > 1 || o.parallel) {
+		panic("bbhash: compatible hash and partitions or parallel not supported")
+	}
 	if len(keys) < 1000 || o.partitions == 1 {
 		bb := newBBHash(o.initialLevels)
 		var err error
 		switch {
+		case o.compatibleHash && !o.reverseMap:
+			bb.computeCPP(keys, o.gamma)
+		case o.compatibleHash && o.reverseMap:
+			bb.computeCPPWithKeymap(keys, o.gamma)
 		case !o.reverseMap && !o.parallel:
 			err = bb.compute(keys, o.gamma)
 		case o.reverseMap && !o.parallel:
@@ -40,6 +51,9 @@ func New(keys []uint64, opts ...Options) (*BBHash2, error) {
 		if err != nil {
 			return nil, err
 		}
+		if o.compressReverseMap {
+			bb.compressReverseMap()
+		}
 		return &BBHash2{
 			partitions: []BBHash{bb},
 			offsets:    []uint32{0},
@@ -69,10 +83,16 @@ func newPartitioned(keys []uint64, o *options) (*BBHash2, error) {
 		offset += len(partitionKeys[j])
 		grp.Go(func() error {
 			bb.partitions[j] = newBBHash(o.initialLevels)
-			if o.reverseMap {
-				return bb.partitions[j].computeWithKeymap(partitionKeys[j], o.gamma)
+			if !o.reverseMap {
+				return bb.partitions[j].compute(partitionKeys[j], o.gamma)
+			}
+			if err := bb.partitions[j].computeWithKeymap(partitionKeys[j], o.gamma); err != nil {
+				return err
+			}
+			if o.compressReverseMap {
+				bb.partitions[j].compressReverseMap()
 			}
-			return bb.partitions[j].compute(partitionKeys[j], o.gamma)
+			return nil
 		})
 	}
 	if err := grp.Wait(); err != nil {
@@ -92,21 +112,130 @@ func newPartitioned(keys []uint64, o *options) (*BBHash2, error) {
 // If the key is not in the original key set, two things can happen:
 // 1. The return value is 0, representing that the key was not in the original key set.
 // 2. The return value is in the expected range [1, len(keys)], but is a false positive.
+//
+// Find returns 0 for the zero value of BBHash2.
 func (bb BBHash2) Find(key uint64) uint64 {
+	if len(bb.partitions) == 0 {
+		return 0
+	}
+	i := key % uint64(len(bb.partitions))
+	index := bb.partitions[i].Find(key)
+	if index == 0 {
+		return 0
+	}
+	return index + uint64(bb.offsets[i])
+}
+
+// Lookup returns the index of the key in the range [1, len(keys)] and true,
+// or 0 and false if the key is not found. As with Find, a key that is not in
+// the original key set may be reported as found (a false positive).
+func (bb BBHash2) Lookup(key uint64) (uint64, bool) {
+	index := bb.Find(key)
+	return index, index != 0
+}
+
+// Index is like Lookup, but returns a 0-based index in the range [0, len(keys)),
+// suitable for indexing a slice of values, or 0 and false if the key is not found.
+func (bb BBHash2) Index(key uint64) (uint64, bool) {
+	index := bb.Find(key)
+	if index == 0 {
+		return 0, false
+	}
+	return index - 1, true
+}
+
+// FindExact returns the index of the key in the range [1, len(keys)] and true,
+// or 0 and false if the key is not in the original key set. Unlike Lookup,
+// FindExact has no false positives, since it compares the key with the key
+// stored in the reverse map. FindExact panics if the BBHash2 has no reverse map.
+func (bb BBHash2) FindExact(key uint64) (uint64, bool) {
+	if !bb.HasReverseMap() {
+		panic("bbhash: FindExact requires a reverse map (see WithReverseMap)")
+	}
 	i := key % uint64(len(bb.partitions))
-	return bb.partitions[i].Find(key) + uint64(bb.offsets[i])
+	index, ok := bb.partitions[i].FindExact(key)
+	if !ok {
+		return 0, false
+	}
+	return index + uint64(bb.offsets[i]), true
+}
+
+// Contains returns true if the key is in the original key set.
+// Contains panics if the BBHash2 has no reverse map.
+func (bb BBHash2) Contains(key uint64) bool {
+	_, ok := bb.FindExact(key)
+	return ok
 }
 
 // Key returns the key for the given index.
 // The index must be in the range [1, len(keys)], otherwise 0 is returned.
+// Since 0 is also a valid key, use LookupKey to distinguish invalid indices.
 func (bb BBHash2) Key(index uint64) uint64 {
+	key, _ := bb.LookupKey(index)
+	return key
+}
+
+// LookupKey returns the key for the given index and true, or 0 and false if the
+// index is not in the range [1, len(keys)] or the BBHash2 has no reverse map.
+func (bb BBHash2) LookupKey(index uint64) (uint64, bool) {
+	if index == 0 {
+		return 0, false
+	}
+	// The indices of partition i are in the range (offsets[i], offsets[i+1]], so the
+	// index belongs to the last partition whose offset is less than the index.
+	// Empty partitions have the same offset as the next partition and are skipped.
+	i := sort.Search(len(bb.offsets), func(j int) bool { return uint64(bb.offsets[j]) >= index }) - 1
+	if i < 0 {
+		return 0, false
+	}
+	return bb.partitions[i].LookupKey(index - uint64(bb.offsets[i]))
+}
+
+// Len returns the number of keys in the BBHash2.
+func (bb BBHash2) Len() int {
+	if len(bb.partitions) == 0 {
+		return 0
+	}
+	last := len(bb.partitions) - 1
+	return int(bb.offsets[last]) + bb.partitions[last].Len()
+}
+
+// All returns an iterator over the (index, key) pairs of the BBHash2 in index order,
+// with indices in the range [1, Len()]. All panics if the BBHash2 has no reverse map.
+//
+// The keys can be used to rebuild the BBHash2 with different options:
+//
+//	keys := slices.Collect(bb.Keys())
+//	rebuilt, err := bbhash.New(keys, bbhash.Gamma(1.5), bbhash.WithReverseMap())
+func (bb BBHash2) All() iter.Seq2[uint64, uint64] {
+	if !bb.HasReverseMap() {
+		panic("bbhash: All requires a reverse map (see WithReverseMap)")
+	}
+	return func(yield func(uint64, uint64) bool) {
+		for i, b := range bb.partitions {
+			if !b.all(uint64(bb.offsets[i]), yield) {
+				return
+			}
+		}
+	}
+}
+
+// Keys returns an iterator over the keys of the BBHash2 in index order.
+// Keys panics if the BBHash2 has no reverse map.
+func (bb BBHash2) Keys() iter.Seq[uint64] {
+	return keys(bb.All())
+}
+
+// HasReverseMap returns true if all partitions of the BBHash2 have a reverse map,
+// that is, if the BBHash2 was created with WithReverseMap or decoded from an
+// indexed encoding that includes the reverse map.
+func (bb BBHash2) HasReverseMap() bool {
 	for _, b := range bb.partitions {
-		if index < uint64(len(b.reverseMap)) {
-			return b.reverseMap[index]
+		if !b.HasReverseMap() {
+			return false
 		}
-		index -= uint64(len(b.reverseMap)) - 1
 	}
-	return 0
+	return len(bb.partitions) > 0
 }
 
 // Partitions returns the number of partitions in the BBHash2.
@@ -86,3 +86,81 @@ func TestNewOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestFindNotFound(t *testing.T) {
+	const (
+		size       = 10000
+		partitions = 8
+	)
+	keys := generateKeys(size, 99)
+	bb, err := bbhash.New(keys, bbhash.Partitions(partitions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each partition is built from the keys routed to it, so a BBHash2 built from
+	// the same keys without partitioning finds exactly the same keys.
+	partitionKeys := make([][]uint64, partitions)
+	for _, k := range keys {
+		partitionKeys[k%partitions] = append(partitionKeys[k%partitions], k)
+	}
+	refs := make([]*bbhash.BBHash2, partitions)
+	for i, pk := range partitionKeys {
+		if refs[i], err = bbhash.New(pk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var notFound int
+	for _, k := range generateKeys(size, 100) {
+		index, ok := bb.Lookup(k)
+		if want := refs[k%partitions].Find(k) != 0; ok != want {
+			t.Errorf("Lookup(%d) = %d, %t, want found=%t", k, index, ok, want)
+		}
+		if got := bb.Find(k); got != index {
+			t.Errorf("Find(%d) = %d, want %d", k, got, index)
+		}
+		if !ok {
+			notFound++
+			if index != 0 {
+				t.Errorf("Lookup(%d) = %d, false, want 0", k, index)
+			}
+			if index, ok := bb.Index(k); ok || index != 0 {
+				t.Errorf("Index(%d) = %d, %t, want 0, false", k, index, ok)
+			}
+			continue
+		}
+		if index < 1 || index > size {
+			t.Errorf("Lookup(%d) = %d, want index in [1, %d]", k, index, size)
+		}
+	}
+	if notFound == 0 {
+		t.Error("all unknown keys were found, want some not found")
+	}
+
+	for _, k := range keys {
+		index, ok := bb.Index(k)
+		if !ok || index != bb.Find(k)-1 {
+			t.Errorf("Index(%d) = %d, %t, want %d, true", k, index, ok, bb.Find(k)-1)
+		}
+	}
+}
+
+func TestZeroValue(t *testing.T) {
+	var bb bbhash.BBHash2
+	if got := bb.Find(1); got != 0 {
+		t.Errorf("Find(1) = %d, want 0", got)
+	}
+	if index, ok := bb.Lookup(1); ok || index != 0 {
+		t.Errorf("Lookup(1) = %d, %t, want 0, false", index, ok)
+	}
+	if index, ok := bb.Index(1); ok || index != 0 {
+		t.Errorf("Index(1) = %d, %t, want 0, false", index, ok)
+	}
+	if got := bb.Key(1); got != 0 {
+		t.Errorf("Key(1) = %d, want 0", got)
+	}
+	var single bbhash.BBHash
+	if index, ok := single.Index(1); ok || index != 0 {
+		t.Errorf("BBHash.Index(1) = %d, %t, want 0, false", index, ok)
+	}
+}
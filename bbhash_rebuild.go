@@ -0,0 +1,38 @@
+package bbhash
+
+import (
+	"errors"
+	"slices"
+)
+
+// Rebuild creates a new BBHash2 from the keys in the reverse map of bb, using the
+// given options. This allows tuning gamma or the number of partitions of a deployed
+// function without the original key set. The options are applied as for New, so
+// the returned BBHash2 only has a reverse map if WithReverseMap or
+// WithCompressedReverseMap is given. Rebuild returns an error if bb has no reverse map.
+func (bb BBHash2) Rebuild(opts ...Options) (*BBHash2, error) {
+	if !bb.HasReverseMap() {
+		return nil, errors.New("BBHash2.Rebuild: no reverse map (see WithReverseMap)")
+	}
+	return New(slices.Collect(bb.Keys()), opts...)
+}
+
+// RebuildRemap is like Rebuild, but also returns a remapping from the 0-based indices
+// of bb to the 0-based indices of the returned BBHash2. That is, remap[i] is the new
+// index of the key that had index i, so that values stored in index order can be
+// permuted to match the new function:
+//
+//	for i, v := range values {
+//		newValues[remap[i]] = v
+//	}
+func (bb BBHash2) RebuildRemap(opts ...Options) (*BBHash2, []uint64, error) {
+	rebuilt, err := bb.Rebuild(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	remap := make([]uint64, bb.Len())
+	for index, key := range bb.All() {
+		remap[index-1] = rebuilt.Find(key) - 1
+	}
+	return rebuilt, remap, nil
+}
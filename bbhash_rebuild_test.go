@@ -0,0 +1,94 @@
+package bbhash_test
+
+import (
+	"testing"
+
+	"github.com/relab/bbhash"
+	"github.com/relab/bbhash/internal/test"
+)
+
+func TestRebuild(t *testing.T) {
+	keys := generateKeys(10_000, 99)
+	testCases := []struct {
+		partitions    int
+		newPartitions int
+		compressed    bool
+	}{
+		{partitions: 1, newPartitions: 1},
+		{partitions: 1, newPartitions: 8},
+		{partitions: 8, newPartitions: 1},
+		{partitions: 4, newPartitions: 16, compressed: true},
+	}
+	for _, tc := range testCases {
+		t.Run(test.Name("", []string{"partitions", "newPartitions", "compressed"}, tc.partitions, tc.newPartitions, tc.compressed), func(t *testing.T) {
+			opt := bbhash.WithReverseMap()
+			if tc.compressed {
+				opt = bbhash.WithCompressedReverseMap()
+			}
+			bb, err := bbhash.New(keys, bbhash.Partitions(tc.partitions), opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// round-trip through the indexed encoding, so we rebuild a loaded function
+			data, err := bb.MarshalIndexed()
+			if err != nil {
+				t.Fatal(err)
+			}
+			loaded := &bbhash.BBHash2{}
+			if err := loaded.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+
+			rebuilt, remap, err := loaded.RebuildRemap(bbhash.Gamma(1.5), bbhash.Partitions(tc.newPartitions), bbhash.WithReverseMap())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rebuilt.Partitions() != tc.newPartitions {
+				t.Errorf("Partitions() = %d, want %d", rebuilt.Partitions(), tc.newPartitions)
+			}
+			if rebuilt.Len() != len(keys) || len(remap) != len(keys) {
+				t.Fatalf("Len() = %d, len(remap) = %d, want %d", rebuilt.Len(), len(remap), len(keys))
+			}
+
+			// values[i] is the value of the key with index i in bb
+			values := make([]uint64, len(keys))
+			for _, key := range keys {
+				i, _ := bb.Index(key)
+				values[i] = key
+			}
+			newValues := make([]uint64, len(values))
+			for i, v := range values {
+				newValues[remap[i]] = v
+			}
+			for _, key := range keys {
+				i, ok := rebuilt.Index(key)
+				if !ok {
+					t.Fatalf("rebuilt Index(%d) not found", key)
+				}
+				if newValues[i] != key {
+					t.Fatalf("newValues[%d] = %d, want %d", i, newValues[i], key)
+				}
+				if !rebuilt.Contains(key) {
+					t.Fatalf("rebuilt Contains(%d) = false, want true", key)
+				}
+			}
+		})
+	}
+}
+
+func TestRebuildWithoutReverseMap(t *testing.T) {
+	bb, err := bbhash.New(generateKeys(100, 99))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bb.Rebuild(); err == nil {
+		t.Error("Rebuild succeeded without a reverse map")
+	}
+	if _, _, err := bb.RebuildRemap(); err == nil {
+		t.Error("RebuildRemap succeeded without a reverse map")
+	}
+	var zero bbhash.BBHash2
+	if _, err := zero.Rebuild(); err == nil {
+		t.Error("Rebuild succeeded on the zero value")
+	}
+}
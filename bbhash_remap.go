@@ -0,0 +1,105 @@
+package bbhash
+
+import (
+	"errors"
+	"iter"
+	"math/bits"
+)
+
+// IndexChange describes the indices of a key in an old and a new BBHash2.
+// Old is 0 if the key was added, and New is 0 if the key was removed.
+type IndexChange struct {
+	Key uint64
+	Old uint64
+	New uint64
+}
+
+// IndexChanges returns an iterator over the changes from oldBB to newBB,
+// without holding them in memory. It first yields the keys of oldBB in old index order,
+// with New set to 0 for removed keys, and then the added keys in new index order.
+// This allows value files indexed by Find to be migrated in a single streaming pass
+// over the old indices. IndexChanges panics if oldBB or newBB has no reverse map.
+func IndexChanges(oldBB, newBB *BBHash2) iter.Seq[IndexChange] {
+	if !oldBB.HasReverseMap() || !newBB.HasReverseMap() {
+		panic("bbhash: IndexChanges requires a reverse map (see WithReverseMap)")
+	}
+	return func(yield func(IndexChange) bool) {
+		for index, key := range oldBB.All() {
+			newIndex, _ := newBB.FindExact(key)
+			if !yield(IndexChange{Key: key, Old: index, New: newIndex}) {
+				return
+			}
+		}
+		for index, key := range newBB.All() {
+			if oldBB.Contains(key) {
+				continue
+			}
+			if !yield(IndexChange{Key: key, New: index}) {
+				return
+			}
+		}
+	}
+}
+
+// IndexMapping maps the indices of an old BBHash2 to the indices of a new BBHash2
+// built over an overlapping key set. The mapping uses log2(n+1) bits per old index,
+// where n is the number of keys in the new BBHash2.
+type IndexMapping struct {
+	n uint64     // number of indices in the old BBHash2
+	m packedInts // m.get(i) is the new index of the key with old index i+1, or 0 if removed
+
+	// Added holds the keys of the new BBHash2 that are not in the old, in new index order.
+	Added []uint64
+	// Removed holds the keys of the old BBHash2 that are not in the new, in old index order.
+	Removed []uint64
+}
+
+// NewIndexMapping returns the mapping from the indices of oldBB to the indices of newBB.
+// Both oldBB and newBB must have a reverse map.
+func NewIndexMapping(oldBB, newBB *BBHash2) (*IndexMapping, error) {
+	if !oldBB.HasReverseMap() || !newBB.HasReverseMap() {
+		return nil, errors.New("bbhash.NewIndexMapping: no reverse map (see WithReverseMap)")
+	}
+	n := uint64(oldBB.Len())
+	m := &IndexMapping{n: n, m: newPackedInts(n, uint(bits.Len64(uint64(newBB.Len()))))}
+	for c := range IndexChanges(oldBB, newBB) {
+		switch {
+		case c.Old == 0:
+			m.Added = append(m.Added, c.Key)
+		case c.New == 0:
+			m.Removed = append(m.Removed, c.Key)
+		default:
+			m.m.set(c.Old-1, c.New)
+		}
+	}
+	return m, nil
+}
+
+// Len returns the number of indices in the old BBHash2.
+func (m *IndexMapping) Len() int {
+	return int(m.n)
+}
+
+// Get returns the new index of the key with the given old index, and whether the key
+// is in the new BBHash2. The indices are 1-based, as returned by Find.
+func (m *IndexMapping) Get(oldIndex uint64) (uint64, bool) {
+	if oldIndex == 0 || oldIndex > m.n {
+		return 0, false
+	}
+	newIndex := m.m.get(oldIndex - 1)
+	return newIndex, newIndex != 0
+}
+
+// All returns an iterator over the (old, new) index pairs of the keys that are in
+// both the old and the new BBHash2, in old index order.
+func (m *IndexMapping) All() iter.Seq2[uint64, uint64] {
+	return func(yield func(uint64, uint64) bool) {
+		for i := range m.n {
+			if newIndex := m.m.get(i); newIndex != 0 {
+				if !yield(i+1, newIndex) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package bbhash_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/relab/bbhash"
+	"github.com/relab/bbhash/internal/test"
+)
+
+func TestIndexMapping(t *testing.T) {
+	keys := generateKeys(12_000, 99)
+	oldKeys, newKeys := keys[:10_000], keys[2_000:]
+	for _, partitions := range []int{1, 4} {
+		t.Run(test.Name("", []string{"partitions"}, partitions), func(t *testing.T) {
+			oldBB, err := bbhash.New(oldKeys, bbhash.Partitions(partitions), bbhash.WithReverseMap())
+			if err != nil {
+				t.Fatal(err)
+			}
+			newBB, err := bbhash.New(newKeys, bbhash.Partitions(partitions), bbhash.WithCompressedReverseMap())
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := bbhash.NewIndexMapping(oldBB, newBB)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Len() != len(oldKeys) {
+				t.Errorf("Len() = %d, want %d", m.Len(), len(oldKeys))
+			}
+			for i, key := range oldKeys {
+				newIndex, ok := m.Get(oldBB.Find(key))
+				wantOK := i >= 2_000
+				if ok != wantOK || (ok && newIndex != newBB.Find(key)) {
+					t.Fatalf("Get(%d) = %d, %t, want %d, %t", oldBB.Find(key), newIndex, ok, newBB.Find(key), wantOK)
+				}
+			}
+			if _, ok := m.Get(0); ok {
+				t.Error("Get(0) = _, true, want false")
+			}
+			if _, ok := m.Get(uint64(m.Len()) + 1); ok {
+				t.Error("Get(Len()+1) = _, true, want false")
+			}
+
+			wantRemoved := slices.SortedFunc(slices.Values(oldKeys[:2_000]), func(a, b uint64) int { return int(oldBB.Find(a)) - int(oldBB.Find(b)) })
+			if diff := cmp.Diff(wantRemoved, m.Removed); diff != "" {
+				t.Errorf("Removed mismatch (-want +got):\n%s", diff)
+			}
+			wantAdded := slices.SortedFunc(slices.Values(keys[10_000:]), func(a, b uint64) int { return int(newBB.Find(a)) - int(newBB.Find(b)) })
+			if diff := cmp.Diff(wantAdded, m.Added); diff != "" {
+				t.Errorf("Added mismatch (-want +got):\n%s", diff)
+			}
+
+			var retained, prev int
+			for oldIndex, newIndex := range m.All() {
+				if int(oldIndex) <= prev {
+					t.Fatalf("All() yielded old index %d after %d", oldIndex, prev)
+				}
+				prev = int(oldIndex)
+				if key := oldBB.Key(oldIndex); newBB.Key(newIndex) != key {
+					t.Fatalf("All() yielded (%d, %d), but newBB.Key(%d) = %d, want %d", oldIndex, newIndex, newIndex, newBB.Key(newIndex), key)
+				}
+				retained++
+			}
+			if retained != 8_000 {
+				t.Errorf("All() yielded %d pairs, want %d", retained, 8_000)
+			}
+
+			var added, removed int
+			for c := range bbhash.IndexChanges(oldBB, newBB) {
+				switch {
+				case c.Old == 0:
+					added++
+				case c.New == 0:
+					removed++
+				}
+			}
+			if added != len(m.Added) || removed != len(m.Removed) {
+				t.Errorf("IndexChanges yielded %d added and %d removed, want %d and %d", added, removed, len(m.Added), len(m.Removed))
+			}
+		})
+	}
+}
+
+func TestIndexMappingWithoutReverseMap(t *testing.T) {
+	keys := generateKeys(100, 99)
+	withMap, err := bbhash.New(keys, bbhash.WithReverseMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	without, err := bbhash.New(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bbhash.NewIndexMapping(withMap, without); err == nil {
+		t.Error("NewIndexMapping succeeded without a reverse map in newBB")
+	}
+	if _, err := bbhash.NewIndexMapping(without, withMap); err == nil {
+		t.Error("NewIndexMapping succeeded without a reverse map in oldBB")
+	}
+}
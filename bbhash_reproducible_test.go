@@ -15,7 +15,7 @@ import (
 	"github.com/relab/bbhash/internal/test"
 )
 
-var update = flag.Bool("update", false, "update bit vectors golden test file")
+var update = flag.Bool("update", false, "update golden test files")
 
 // To update the bit vectors golden test file, run:
 //
@@ -0,0 +1,151 @@
+package bbhash
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// signedMagic identifies a signed BBHash2 encoding.
+	signedMagic = "BBHS"
+
+	// signedVersion is the version of the signed encoding.
+	signedVersion = 1
+
+	// signedHeaderLength is the length of the signed header: magic, version and payload length.
+	signedHeaderLength = len(signedMagic) + 1 + uint64bytes
+)
+
+// MarshalSigned returns the encoding of the BBHash2 with an embedded ed25519 signature.
+// The signed encoding consists of a header, the indexed BBHash2 encoding (the payload),
+// which includes the reverse map if present, and a signature by priv covering the header
+// and the payload. Use a Verifier to check the signature and decode the BBHash2.
+func (b2 BBHash2) MarshalSigned(priv ed25519.PrivateKey) ([]byte, error) {
+	if len(priv) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("BBHash2.MarshalSigned: invalid private key length %d", len(priv))
+	}
+	if len(b2.partitions) == 0 {
+		return nil, errors.New("BBHash2.MarshalSigned: no data")
+	}
+	b2Len := b2.indexedLength()
+	buf := make([]byte, 0, signedHeaderLength+b2Len+ed25519.SignatureSize)
+
+	// append header: magic, version and the payload length
+	buf = append(buf, signedMagic...)
+	buf = append(buf, signedVersion)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(b2Len))
+
+	buf, err := b2.AppendIndexed(buf)
+	if err != nil {
+		return nil, err
+	}
+	// append the signature over the header and payload
+	return append(buf, ed25519.Sign(priv, buf)...), nil
+}
+
+// SignDetached returns an ed25519 signature of data, typically the output of
+// BBHash2.MarshalBinary or BBHash2.MarshalIndexed, to be distributed alongside
+// the data. Use Verifier.UnmarshalDetached to check the signature and decode.
+func SignDetached(data []byte, priv ed25519.PrivateKey) ([]byte, error) {
+	if len(priv) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("bbhash.SignDetached: invalid private key length %d", len(priv))
+	}
+	return ed25519.Sign(priv, data), nil
+}
+
+// Verifier checks the signature of a signed BBHash2 encoding before decoding it.
+// Invalid signatures are always refused. Unsigned encodings are refused unless
+// AllowUnsigned is set.
+type Verifier struct {
+	// PublicKeys holds the trusted keys; a valid signature by any of them is accepted.
+	PublicKeys []ed25519.PublicKey
+
+	// AllowUnsigned permits decoding of encodings without a signature.
+	AllowUnsigned bool
+}
+
+// Unmarshal verifies and decodes data produced by BBHash2.MarshalSigned.
+// If AllowUnsigned is set, data may also be an unsigned BBHash2 encoding.
+// Data that starts like a signed encoding, but whose header is malformed,
+// is always refused.
+func (v Verifier) Unmarshal(data []byte) (*BBHash2, error) {
+	payload, sig, signed, err := splitSigned(data)
+	if err != nil {
+		return nil, fmt.Errorf("Verifier.Unmarshal: %w", err)
+	}
+	if !signed {
+		return v.unmarshalUnsigned(data)
+	}
+	if !v.verify(data[:len(data)-ed25519.SignatureSize], sig) {
+		return nil, errors.New("Verifier.Unmarshal: invalid signature")
+	}
+	b2 := &BBHash2{}
+	if err := b2.UnmarshalBinary(payload); err != nil {
+		return nil, err
+	}
+	return b2, nil
+}
+
+// UnmarshalDetached verifies the detached signature sig of data, as produced by
+// SignDetached, and decodes data. If AllowUnsigned is set, sig may be nil.
+func (v Verifier) UnmarshalDetached(data, sig []byte) (*BBHash2, error) {
+	if sig == nil {
+		return v.unmarshalUnsigned(data)
+	}
+	if !v.verify(data, sig) {
+		return nil, errors.New("Verifier.UnmarshalDetached: invalid signature")
+	}
+	b2 := &BBHash2{}
+	if err := b2.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return b2, nil
+}
+
+// verify returns true if sig is a valid signature of msg by one of the trusted keys.
+func (v Verifier) verify(msg, sig []byte) bool {
+	if len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	for _, pub := range v.PublicKeys {
+		if len(pub) == ed25519.PublicKeySize && ed25519.Verify(pub, msg, sig) {
+			return true
+		}
+	}
+	return false
+}
+
+// unmarshalUnsigned decodes data if unsigned encodings are allowed.
+func (v Verifier) unmarshalUnsigned(data []byte) (*BBHash2, error) {
+	if !v.AllowUnsigned {
+		return nil, errors.New("Verifier: refusing unsigned data")
+	}
+	b2 := &BBHash2{}
+	if err := b2.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return b2, nil
+}
+
+// splitSigned returns the payload and signature of a signed encoding.
+// It returns false if data does not start with the magic of a signed encoding,
+// and an error if it does, but the header is malformed.
+func splitSigned(data []byte) (payload, sig []byte, signed bool, err error) {
+	if len(data) < len(signedMagic) || string(data[:len(signedMagic)]) != signedMagic {
+		return nil, nil, false, nil
+	}
+	if len(data) < signedHeaderLength+ed25519.SignatureSize {
+		return nil, nil, true, errors.New("insufficient data for signed encoding")
+	}
+	if version := data[len(signedMagic)]; version != signedVersion {
+		return nil, nil, true, fmt.Errorf("unsupported signed encoding version %d (want %d)", version, signedVersion)
+	}
+	payloadLen := binary.LittleEndian.Uint64(data[len(signedMagic)+1:])
+	if want := uint64(len(data) - signedHeaderLength - ed25519.SignatureSize); payloadLen != want {
+		return nil, nil, true, fmt.Errorf("signed payload length %d does not match %d", payloadLen, want)
+	}
+	sigStart := len(data) - ed25519.SignatureSize
+	return data[signedHeaderLength:sigStart], data[sigStart:], true, nil
+}
@@ -0,0 +1,180 @@
+package bbhash_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"strings"
+	"testing"
+
+	"github.com/relab/bbhash"
+)
+
+func TestSigned(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := generateKeys(10000, 98)
+	bb, err := bbhash.New(keys, bbhash.Partitions(4))
+	if err != nil {
+		t.Fatalf("Failed to create BBHash2: %v", err)
+	}
+	signed, err := bb.MarshalSigned(priv)
+	if err != nil {
+		t.Fatalf("MarshalSigned() failed: %v", err)
+	}
+	unsigned, err := bb.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() failed: %v", err)
+	}
+	tampered := bytes.Clone(signed)
+	tampered[len(tampered)/2] ^= 1
+
+	tests := []struct {
+		name    string
+		v       bbhash.Verifier
+		data    []byte
+		wantErr bool
+	}{
+		{name: "valid", v: bbhash.Verifier{PublicKeys: []ed25519.PublicKey{pub}}, data: signed},
+		{name: "valid/second key", v: bbhash.Verifier{PublicKeys: []ed25519.PublicKey{otherPub, pub}}, data: signed},
+		{name: "untrusted key", v: bbhash.Verifier{PublicKeys: []ed25519.PublicKey{otherPub}}, data: signed, wantErr: true},
+		{name: "no keys", v: bbhash.Verifier{}, data: signed, wantErr: true},
+		{name: "tampered", v: bbhash.Verifier{PublicKeys: []ed25519.PublicKey{pub}}, data: tampered, wantErr: true},
+		{name: "tampered/allow unsigned", v: bbhash.Verifier{PublicKeys: []ed25519.PublicKey{pub}, AllowUnsigned: true}, data: tampered, wantErr: true},
+		{name: "unsigned", v: bbhash.Verifier{PublicKeys: []ed25519.PublicKey{pub}}, data: unsigned, wantErr: true},
+		{name: "unsigned/allow unsigned", v: bbhash.Verifier{AllowUnsigned: true}, data: unsigned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.v.Unmarshal(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			for _, key := range keys {
+				if got.Find(key) != bb.Find(key) {
+					t.Fatalf("Find(%d) = %d, want %d", key, got.Find(key), bb.Find(key))
+				}
+			}
+		})
+	}
+}
+
+func TestSignDetached(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := generateKeys(10000, 98)
+	bb, err := bbhash.New(keys, bbhash.Partitions(4))
+	if err != nil {
+		t.Fatalf("Failed to create BBHash2: %v", err)
+	}
+	data, err := bb.MarshalIndexed()
+	if err != nil {
+		t.Fatalf("MarshalIndexed() failed: %v", err)
+	}
+	sig, err := bbhash.SignDetached(data, priv)
+	if err != nil {
+		t.Fatalf("SignDetached() failed: %v", err)
+	}
+
+	v := bbhash.Verifier{PublicKeys: []ed25519.PublicKey{pub}}
+	got, err := v.UnmarshalDetached(data, sig)
+	if err != nil {
+		t.Fatalf("UnmarshalDetached() failed: %v", err)
+	}
+	for _, key := range keys {
+		if got.Find(key) != bb.Find(key) {
+			t.Fatalf("Find(%d) = %d, want %d", key, got.Find(key), bb.Find(key))
+		}
+	}
+
+	tampered := bytes.Clone(data)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := v.UnmarshalDetached(tampered, sig); err == nil {
+		t.Error("UnmarshalDetached() should have failed for tampered data")
+	}
+	if _, err := v.UnmarshalDetached(data, nil); err == nil {
+		t.Error("UnmarshalDetached() should have failed for a missing signature")
+	}
+	v.AllowUnsigned = true
+	if _, err := v.UnmarshalDetached(data, nil); err != nil {
+		t.Errorf("UnmarshalDetached() with AllowUnsigned failed: %v", err)
+	}
+}
+
+func TestSignedReverseMap(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := generateKeys(10000, 98)
+	bb, err := bbhash.New(keys, bbhash.Partitions(4), bbhash.WithReverseMap())
+	if err != nil {
+		t.Fatalf("Failed to create BBHash2: %v", err)
+	}
+	signed, err := bb.MarshalSigned(priv)
+	if err != nil {
+		t.Fatalf("MarshalSigned() failed: %v", err)
+	}
+	got, err := bbhash.Verifier{PublicKeys: []ed25519.PublicKey{pub}}.Unmarshal(signed)
+	if err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+	if !got.HasReverseMap() {
+		t.Fatal("HasReverseMap() = false after signing, want true")
+	}
+	for _, key := range keys {
+		if !got.Contains(key) {
+			t.Fatalf("Contains(%d) = false, want true", key)
+		}
+	}
+}
+
+func TestSignedMalformedHeader(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb, err := bbhash.New(generateKeys(1000, 98))
+	if err != nil {
+		t.Fatalf("Failed to create BBHash2: %v", err)
+	}
+	signed, err := bb.MarshalSigned(priv)
+	if err != nil {
+		t.Fatalf("MarshalSigned() failed: %v", err)
+	}
+	badVersion := bytes.Clone(signed)
+	badVersion[4] = 2 // the version follows the 4-byte magic
+	badLength := bytes.Clone(signed)
+	badLength[5]++ // the payload length follows the version
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{name: "version", data: badVersion, wantErr: "version"},
+		{name: "length", data: badLength, wantErr: "length"},
+		{name: "truncated", data: signed[:10], wantErr: "insufficient data"},
+		{name: "trailing data", data: append(bytes.Clone(signed), 0), wantErr: "length"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := bbhash.Verifier{PublicKeys: []ed25519.PublicKey{pub}, AllowUnsigned: true}
+			_, err := v.Unmarshal(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Unmarshal() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -6,11 +6,13 @@ import (
 	"hash/fnv"
 	"math/rand"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/relab/bbhash"
 	"github.com/relab/bbhash/internal/test"
 )
@@ -267,6 +269,230 @@ func TestReverseMapping(t *testing.T) {
 	}
 }
 
+func TestReverseMapKeyZero(t *testing.T) {
+	keys := append([]uint64{0}, generateKeys(2000, 99)...)
+	for _, partitions := range []int{1, 4} {
+		t.Run(test.Name("", []string{"partitions", "keys"}, partitions, len(keys)), func(t *testing.T) {
+			bb, err := bbhash.New(keys, bbhash.Partitions(partitions), bbhash.WithReverseMap())
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := bb.MarshalIndexed()
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded := &bbhash.BBHash2{}
+			if err := decoded.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+			for _, b := range []*bbhash.BBHash2{bb, decoded} {
+				for _, key := range keys {
+					index := b.Find(key)
+					if got, ok := b.LookupKey(index); !ok || got != key {
+						t.Errorf("LookupKey(%d) = %d, %t, want %d, true", index, got, ok, key)
+					}
+					if !b.Contains(key) {
+						t.Errorf("Contains(%d) = false, want true", key)
+					}
+				}
+				for _, index := range []uint64{0, uint64(len(keys)) + 1} {
+					if got, ok := b.LookupKey(index); ok {
+						t.Errorf("LookupKey(%d) = %d, true, want false", index, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCompressedReverseMap(t *testing.T) {
+	// Sequential IDs with gaps, starting far from zero.
+	dense := make([]uint64, 10_000)
+	for i := range dense {
+		dense[i] = 1<<48 + uint64(i)*5 + uint64(i%3)
+	}
+	tests := []struct {
+		name          string
+		keys          []uint64
+		maxBitsPerKey float64
+	}{
+		{name: "dense", keys: dense, maxBitsPerKey: 20},
+		{name: "random", keys: generateKeys(10_000, 99), maxBitsPerKey: 80},
+	}
+	for _, tt := range tests {
+		for _, partitions := range []int{1, 4} {
+			t.Run(test.Name(tt.name, []string{"partitions", "keys"}, partitions, len(tt.keys)), func(t *testing.T) {
+				want, err := bbhash.New(tt.keys, bbhash.Partitions(partitions), bbhash.WithReverseMap())
+				if err != nil {
+					t.Fatal(err)
+				}
+				bb, err := bbhash.New(tt.keys, bbhash.Partitions(partitions), bbhash.WithCompressedReverseMap())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := want.ReverseMapBitsPerKey(); got != 64 {
+					t.Errorf("WithReverseMap: ReverseMapBitsPerKey() = %.1f, want 64", got)
+				}
+				bpk := bb.ReverseMapBitsPerKey()
+				if bpk <= 0 || bpk > tt.maxBitsPerKey {
+					t.Errorf("ReverseMapBitsPerKey() = %.1f, want at most %.1f", bpk, tt.maxBitsPerKey)
+				}
+				if !strings.Contains(bb.String(), "reverse map: compressed") {
+					t.Errorf("String() does not describe the compressed reverse map:\n%s", bb)
+				}
+
+				data, err := bb.MarshalIndexed()
+				if err != nil {
+					t.Fatal(err)
+				}
+				decoded := &bbhash.BBHash2{}
+				if err := decoded.UnmarshalBinary(data); err != nil {
+					t.Fatal(err)
+				}
+				if got := decoded.ReverseMapBitsPerKey(); got != bpk {
+					t.Errorf("decoded ReverseMapBitsPerKey() = %.1f, want %.1f", got, bpk)
+				}
+				for _, b := range []*bbhash.BBHash2{bb, decoded} {
+					for index := uint64(0); index <= uint64(len(tt.keys))+1; index++ {
+						wantKey, wantOK := want.LookupKey(index)
+						if key, ok := b.LookupKey(index); key != wantKey || ok != wantOK {
+							t.Fatalf("LookupKey(%d) = %d, %t, want %d, %t", index, key, ok, wantKey, wantOK)
+						}
+					}
+					for _, key := range tt.keys[:100] {
+						if !b.Contains(key) {
+							t.Errorf("Contains(%d) = false, want true", key)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestFindExact(t *testing.T) {
+	keys := generateKeys(10_000, 99)
+	unknown := generateKeys(10_000, 100)
+	for _, partitions := range []int{1, 5} {
+		t.Run(test.Name("", []string{"partitions", "keys"}, partitions, len(keys)), func(t *testing.T) {
+			bb, err := bbhash.New(keys, bbhash.Partitions(partitions), bbhash.WithReverseMap())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range keys {
+				index, ok := bb.FindExact(key)
+				if !ok || index != bb.Find(key) {
+					t.Errorf("FindExact(%d) = %d, %t, want %d, true", key, index, ok, bb.Find(key))
+				}
+				if !bb.Contains(key) {
+					t.Errorf("Contains(%d) = false, want true", key)
+				}
+			}
+			var falsePositives int
+			for _, key := range unknown {
+				if _, ok := bb.Lookup(key); ok {
+					falsePositives++
+				}
+				if index, ok := bb.FindExact(key); ok || index != 0 {
+					t.Errorf("FindExact(%d) = %d, %t, want 0, false", key, index, ok)
+				}
+				if bb.Contains(key) {
+					t.Errorf("Contains(%d) = true, want false", key)
+				}
+			}
+			if falsePositives == 0 {
+				t.Error("Lookup reported no false positives; test does not exercise FindExact")
+			}
+		})
+	}
+}
+
+func TestFindExactWithoutReverseMap(t *testing.T) {
+	bb, err := bbhash.New(generateKeys(100, 99))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bb.HasReverseMap() {
+		t.Fatal("HasReverseMap() = true, want false")
+	}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("FindExact did not panic without a reverse map")
+		}
+	}()
+	bb.FindExact(1)
+}
+
+func TestAll(t *testing.T) {
+	keys := generateKeys(10_000, 99)
+	for _, partitions := range []int{1, 4} {
+		for _, compressed := range []bool{false, true} {
+			opt := bbhash.WithReverseMap()
+			if compressed {
+				opt = bbhash.WithCompressedReverseMap()
+			}
+			t.Run(test.Name("", []string{"partitions", "compressed", "keys"}, partitions, compressed, len(keys)), func(t *testing.T) {
+				bb, err := bbhash.New(keys, bbhash.Partitions(partitions), opt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := bb.Len(); got != len(keys) {
+					t.Errorf("Len() = %d, want %d", got, len(keys))
+				}
+				want := uint64(1)
+				for index, key := range bb.All() {
+					if index != want {
+						t.Fatalf("All() yielded index %d, want %d", index, want)
+					}
+					if wantKey := bb.Key(index); key != wantKey {
+						t.Fatalf("All() yielded key %d for index %d, want %d", key, index, wantKey)
+					}
+					want++
+				}
+				if want != uint64(len(keys))+1 {
+					t.Errorf("All() yielded %d pairs, want %d", want-1, len(keys))
+				}
+
+				got := slices.Collect(bb.Keys())
+				if diff := cmp.Diff(slices.Sorted(slices.Values(keys)), slices.Sorted(slices.Values(got))); diff != "" {
+					t.Errorf("Keys() mismatch (-want +got):\n%s", diff)
+				}
+				for range bb.Keys() {
+					break // stopping early must not panic
+				}
+
+				rebuilt, err := bbhash.New(got, bbhash.Partitions(partitions), opt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, key := range keys {
+					if !rebuilt.Contains(key) {
+						t.Fatalf("rebuilt Contains(%d) = false, want true", key)
+					}
+				}
+			})
+		}
+	}
+
+	var zero bbhash.BBHash2
+	if got := zero.Len(); got != 0 {
+		t.Errorf("zero value Len() = %d, want 0", got)
+	}
+	bb, err := bbhash.New(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bb.Len(); got != len(keys) {
+		t.Errorf("without reverse map: Len() = %d, want %d", got, len(keys))
+	}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("All did not panic without a reverse map")
+		}
+	}()
+	bb.All()
+}
+
 // BenchmarkReverseMapping benchmarks the speed of building a reverse map.
 // The original implementation using New(Sequential)+Find is very slow;
 // with 10_000_000 keys it takes more than 13 hours on a Mac Studio M2 Max 64GB.
@@ -298,6 +524,54 @@ func BenchmarkReverseMapping(b *testing.B) {
 	}
 }
 
+// BenchmarkReverseLookup benchmarks looking up the key of every index with LookupKey.
+//
+//	go test -run x -bench BenchmarkReverseLookup -benchmem -count 10 > key.txt
+func BenchmarkReverseLookup(b *testing.B) {
+	for _, size := range keySizes {
+		keys := generateKeys(size, 99)
+		for _, partitions := range partitionValues {
+			bb, err := bbhash.New(keys, bbhash.Partitions(partitions), bbhash.WithReverseMap())
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Run(test.Name("LookupKey", []string{"partitions", "keys"}, partitions, size), func(b *testing.B) {
+				for b.Loop() {
+					for i := uint64(1); i <= uint64(size); i++ {
+						if _, ok := bb.LookupKey(i); !ok {
+							b.Fatalf("can't find the key of index %d", i)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkCompressedReverseLookup benchmarks looking up the key of every index
+// with LookupKey in a compressed reverse map; compare with BenchmarkReverseLookup.
+func BenchmarkCompressedReverseLookup(b *testing.B) {
+	for _, size := range keySizes {
+		keys := generateKeys(size, 99)
+		for _, partitions := range partitionValues {
+			bb, err := bbhash.New(keys, bbhash.Partitions(partitions), bbhash.WithCompressedReverseMap())
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Run(test.Name("LookupKey", []string{"partitions", "keys"}, partitions, size), func(b *testing.B) {
+				for b.Loop() {
+					for i := uint64(1); i <= uint64(size); i++ {
+						if _, ok := bb.LookupKey(i); !ok {
+							b.Fatalf("can't find the key of index %d", i)
+						}
+					}
+				}
+				b.ReportMetric(bb.ReverseMapBitsPerKey(), "bits/key")
+			})
+		}
+	}
+}
+
 // BenchmarkBBHashNew benchmarks the construction of a new BBHash using
 // sequential and partition variants. This will take a long time to run,
 // especially if you enable large sizes. Thus, to avoid timeouts, you
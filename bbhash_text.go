@@ -0,0 +1,273 @@
+package bbhash
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+)
+
+// The text encoding wraps the binary encoding in an envelope that can be
+// embedded in configuration files. It has the form:
+//
+//	<type>:v<version>:<keys>:<checksum>:<data>
+//
+// where type is bbhash or bbhash2, version is the envelope version (currently 1),
+// keys is the number of keys in the function, checksum is the CRC-32C of the
+// binary encoding as eight hexadecimal digits, and data is the standard base64
+// encoding of the binary encoding. BBHash uses its binary encoding, and BBHash2
+// uses its indexed encoding, which includes the reverse map if present.
+//
+// The JSON encoding is an object with the same fields:
+//
+//	{"type":"bbhash2","version":1,"keys":1000,"checksum":"1a2b3c4d","data":"AAIB..."}
+//
+// UnmarshalJSON also accepts the text encoding as a JSON string.
+
+const (
+	// textVersion is the version of the text and JSON envelopes.
+	textVersion = 1
+
+	textTypeBBHash  = "bbhash"
+	textTypeBBHash2 = "bbhash2"
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// textEnvelope is the JSON representation of the text envelope.
+type textEnvelope struct {
+	Type     string `json:"type"`
+	Version  int    `json:"version"`
+	Keys     uint64 `json:"keys"`
+	Checksum string `json:"checksum"`
+	Data     []byte `json:"data"`
+}
+
+// newTextEnvelope returns an envelope for the binary encoding data.
+func newTextEnvelope(typ string, keys uint64, data []byte) *textEnvelope {
+	return &textEnvelope{
+		Type:     typ,
+		Version:  textVersion,
+		Keys:     keys,
+		Checksum: checksum(data),
+		Data:     data,
+	}
+}
+
+// checksum returns the CRC-32C checksum of data as eight hexadecimal digits.
+func checksum(data []byte) string {
+	return fmt.Sprintf("%08x", crc32.Checksum(data, crc32c))
+}
+
+// appendText appends the text form of the envelope to buf.
+func (e *textEnvelope) appendText(buf []byte) []byte {
+	buf = fmt.Appendf(buf, "%s:v%d:%d:%s:", e.Type, e.Version, e.Keys, e.Checksum)
+	return base64.StdEncoding.AppendEncode(buf, e.Data)
+}
+
+// parseTextEnvelope parses the text form of an envelope.
+func parseTextEnvelope(text []byte) (*textEnvelope, error) {
+	fields := bytes.SplitN(text, []byte(":"), 5)
+	if len(fields) != 5 || len(fields[1]) < 2 || fields[1][0] != 'v' {
+		return nil, errors.New("malformed text encoding")
+	}
+	version, err := strconv.Atoi(string(fields[1][1:]))
+	if err != nil {
+		return nil, fmt.Errorf("malformed version: %w", err)
+	}
+	keys, err := strconv.ParseUint(string(fields[2]), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed key count: %w", err)
+	}
+	data, err := base64.StdEncoding.AppendDecode(nil, fields[4])
+	if err != nil {
+		return nil, fmt.Errorf("malformed data: %w", err)
+	}
+	return &textEnvelope{
+		Type:     string(fields[0]),
+		Version:  version,
+		Keys:     keys,
+		Checksum: string(fields[3]),
+		Data:     data,
+	}, nil
+}
+
+// parseJSONEnvelope parses a JSON object or a JSON string holding the text form of an envelope.
+func parseJSONEnvelope(data []byte) (*textEnvelope, error) {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		return parseTextEnvelope([]byte(text))
+	}
+	e := &textEnvelope{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// verify checks the envelope's type, version and checksum, and returns the binary encoding.
+func (e *textEnvelope) verify(typ string) ([]byte, error) {
+	if e.Type != typ {
+		return nil, fmt.Errorf("type %q does not match %q", e.Type, typ)
+	}
+	if e.Version != textVersion {
+		return nil, fmt.Errorf("unsupported version %d (want %d)", e.Version, textVersion)
+	}
+	if sum := checksum(e.Data); e.Checksum != sum {
+		return nil, fmt.Errorf("checksum mismatch: got %s, want %s", sum, e.Checksum)
+	}
+	return e.Data, nil
+}
+
+// envelope returns the text envelope of the BBHash.
+func (bb BBHash) envelope() (*textEnvelope, error) {
+	data, err := bb.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return newTextEnvelope(textTypeBBHash, bb.entries(), data), nil
+}
+
+// unmarshalEnvelope decodes the BBHash from the envelope.
+func (bb *BBHash) unmarshalEnvelope(e *textEnvelope) error {
+	data, err := e.verify(textTypeBBHash)
+	if err != nil {
+		return err
+	}
+	if err := bb.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	if bb.entries() != e.Keys {
+		return fmt.Errorf("key count %d does not match %d", bb.entries(), e.Keys)
+	}
+	return nil
+}
+
+// AppendText implements the [encoding.TextAppender] interface.
+func (bb BBHash) AppendText(buf []byte) ([]byte, error) {
+	e, err := bb.envelope()
+	if err != nil {
+		return nil, err
+	}
+	return e.appendText(buf), nil
+}
+
+// MarshalText implements the [encoding.TextMarshaler] interface.
+func (bb BBHash) MarshalText() ([]byte, error) {
+	return bb.AppendText(nil)
+}
+
+// UnmarshalText implements the [encoding.TextUnmarshaler] interface.
+func (bb *BBHash) UnmarshalText(text []byte) error {
+	e, err := parseTextEnvelope(text)
+	if err != nil {
+		return fmt.Errorf("BBHash.UnmarshalText: %w", err)
+	}
+	if err := bb.unmarshalEnvelope(e); err != nil {
+		return fmt.Errorf("BBHash.UnmarshalText: %w", err)
+	}
+	return nil
+}
+
+// MarshalJSON implements the [json.Marshaler] interface.
+func (bb BBHash) MarshalJSON() ([]byte, error) {
+	e, err := bb.envelope()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(e)
+}
+
+// UnmarshalJSON implements the [json.Unmarshaler] interface.
+// By convention, a JSON null is a no-op.
+func (bb *BBHash) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	e, err := parseJSONEnvelope(data)
+	if err != nil {
+		return fmt.Errorf("BBHash.UnmarshalJSON: %w", err)
+	}
+	if err := bb.unmarshalEnvelope(e); err != nil {
+		return fmt.Errorf("BBHash.UnmarshalJSON: %w", err)
+	}
+	return nil
+}
+
+// envelope returns the text envelope of the BBHash2.
+func (b2 BBHash2) envelope() (*textEnvelope, error) {
+	data, err := b2.MarshalIndexed()
+	if err != nil {
+		return nil, err
+	}
+	return newTextEnvelope(textTypeBBHash2, b2.entries(), data), nil
+}
+
+// unmarshalEnvelope decodes the BBHash2 from the envelope.
+func (b2 *BBHash2) unmarshalEnvelope(e *textEnvelope) error {
+	data, err := e.verify(textTypeBBHash2)
+	if err != nil {
+		return err
+	}
+	if err := b2.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	if b2.entries() != e.Keys {
+		return fmt.Errorf("key count %d does not match %d", b2.entries(), e.Keys)
+	}
+	return nil
+}
+
+// AppendText implements the [encoding.TextAppender] interface.
+func (b2 BBHash2) AppendText(buf []byte) ([]byte, error) {
+	e, err := b2.envelope()
+	if err != nil {
+		return nil, err
+	}
+	return e.appendText(buf), nil
+}
+
+// MarshalText implements the [encoding.TextMarshaler] interface.
+func (b2 BBHash2) MarshalText() ([]byte, error) {
+	return b2.AppendText(nil)
+}
+
+// UnmarshalText implements the [encoding.TextUnmarshaler] interface.
+func (b2 *BBHash2) UnmarshalText(text []byte) error {
+	e, err := parseTextEnvelope(text)
+	if err != nil {
+		return fmt.Errorf("BBHash2.UnmarshalText: %w", err)
+	}
+	if err := b2.unmarshalEnvelope(e); err != nil {
+		return fmt.Errorf("BBHash2.UnmarshalText: %w", err)
+	}
+	return nil
+}
+
+// MarshalJSON implements the [json.Marshaler] interface.
+func (b2 BBHash2) MarshalJSON() ([]byte, error) {
+	e, err := b2.envelope()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(e)
+}
+
+// UnmarshalJSON implements the [json.Unmarshaler] interface.
+// By convention, a JSON null is a no-op.
+func (b2 *BBHash2) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	e, err := parseJSONEnvelope(data)
+	if err != nil {
+		return fmt.Errorf("BBHash2.UnmarshalJSON: %w", err)
+	}
+	if err := b2.unmarshalEnvelope(e); err != nil {
+		return fmt.Errorf("BBHash2.UnmarshalJSON: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package bbhash_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/relab/bbhash"
+)
+
+func TestMarshalUnmarshalTextBBHash(t *testing.T) {
+	keys := generateKeys(10000, 99)
+	bb2, err := bbhash.New(keys)
+	if err != nil {
+		t.Fatalf("Failed to create BBHash: %v", err)
+	}
+	bb := bb2.SinglePartition()
+
+	text, err := bb.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText() failed: %v", err)
+	}
+	if !strings.HasPrefix(string(text), "bbhash:v1:10000:") {
+		t.Errorf("MarshalText() = %.32q..., want prefix %q", text, "bbhash:v1:10000:")
+	}
+	newBB := &bbhash.BBHash{}
+	if err = newBB.UnmarshalText(text); err != nil {
+		t.Fatalf("UnmarshalText() failed: %v", err)
+	}
+	for _, key := range keys {
+		if got, want := newBB.Find(key), bb.Find(key); got != want {
+			t.Fatalf("newBB.Find(%d) = %d, want %d", key, got, want)
+		}
+	}
+
+	// The BBHash2 envelope must be rejected
+	text2, err := bb2.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText() failed: %v", err)
+	}
+	if err = newBB.UnmarshalText(text2); err == nil {
+		t.Error("UnmarshalText(BBHash2 envelope) should have failed")
+	}
+}
+
+func TestMarshalUnmarshalTextBBHash2(t *testing.T) {
+	keys := generateKeys(10000, 99)
+	bb, err := bbhash.New(keys, bbhash.Partitions(4), bbhash.WithReverseMap())
+	if err != nil {
+		t.Fatalf("Failed to create BBHash2: %v", err)
+	}
+	text, err := bb.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText() failed: %v", err)
+	}
+	newBB := &bbhash.BBHash2{}
+	if err = newBB.UnmarshalText(text); err != nil {
+		t.Fatalf("UnmarshalText() failed: %v", err)
+	}
+	for _, key := range keys {
+		idx := bb.Find(key)
+		if got := newBB.Find(key); got != idx {
+			t.Fatalf("newBB.Find(%d) = %d, want %d", key, got, idx)
+		}
+		if got := newBB.Key(idx); got != key {
+			t.Fatalf("newBB.Key(%d) = %d, want %d", idx, got, key)
+		}
+	}
+
+	// Corrupt each field of the envelope in turn
+	fields := strings.SplitN(string(text), ":", 5)
+	corrupt := func(i int, s string) []byte {
+		f := append([]string(nil), fields...)
+		f[i] = s
+		return []byte(strings.Join(f, ":"))
+	}
+	tests := []struct {
+		name string
+		text []byte
+	}{
+		{name: "empty", text: nil},
+		{name: "missing data", text: []byte(strings.Join(fields[:4], ":"))},
+		{name: "type", text: corrupt(0, "bbhash")},
+		{name: "version", text: corrupt(1, "v2")},
+		{name: "keys", text: corrupt(2, "9999")},
+		{name: "checksum", text: corrupt(3, "00000000")},
+		{name: "data", text: corrupt(4, fields[4][:len(fields[4])-8])},
+		{name: "base64", text: corrupt(4, "!"+fields[4][1:])},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := newBB.UnmarshalText(tt.text); err == nil {
+				t.Error("UnmarshalText() should have failed")
+			}
+		})
+	}
+}
+
+func TestMarshalUnmarshalJSON(t *testing.T) {
+	type config struct {
+		Name  string          `json:"name"`
+		Hash  *bbhash.BBHash2 `json:"hash"`
+		Level *bbhash.BBHash  `json:"level"`
+	}
+	keys := generateKeys(1000, 99)
+	bb, err := bbhash.New(keys, bbhash.Partitions(2))
+	if err != nil {
+		t.Fatalf("Failed to create BBHash2: %v", err)
+	}
+	single, err := bbhash.New(keys)
+	if err != nil {
+		t.Fatalf("Failed to create BBHash: %v", err)
+	}
+	in := config{Name: "test", Hash: bb, Level: single.SinglePartition()}
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	for _, field := range []string{`"type":"bbhash2"`, `"type":"bbhash"`, `"version":1`, `"keys":1000`, `"checksum":`} {
+		if !bytes.Contains(data, []byte(field)) {
+			t.Errorf("json.Marshal() = %.64s..., missing %s", data, field)
+		}
+	}
+
+	var out config
+	if err = json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %v", err)
+	}
+	for _, key := range keys {
+		if got, want := out.Hash.Find(key), bb.Find(key); got != want {
+			t.Fatalf("out.Hash.Find(%d) = %d, want %d", key, got, want)
+		}
+		if got, want := out.Level.Find(key), in.Level.Find(key); got != want {
+			t.Fatalf("out.Level.Find(%d) = %d, want %d", key, got, want)
+		}
+	}
+
+	// The text encoding is also accepted as a JSON string
+	text, err := bb.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText() failed: %v", err)
+	}
+	str, err := json.Marshal(string(text))
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	newBB := &bbhash.BBHash2{}
+	if err = newBB.UnmarshalJSON(str); err != nil {
+		t.Fatalf("UnmarshalJSON(string) failed: %v", err)
+	}
+	if got, want := newBB.Find(keys[0]), bb.Find(keys[0]); got != want {
+		t.Errorf("newBB.Find(%d) = %d, want %d", keys[0], got, want)
+	}
+
+	// A JSON null is a no-op
+	if err = newBB.UnmarshalJSON([]byte("null")); err != nil {
+		t.Errorf("UnmarshalJSON(null) failed: %v", err)
+	}
+	if got, want := newBB.Find(keys[0]), bb.Find(keys[0]); got != want {
+		t.Errorf("after UnmarshalJSON(null): newBB.Find(%d) = %d, want %d", keys[0], got, want)
+	}
+	var values struct {
+		Hash  bbhash.BBHash2 `json:"hash"`
+		Level bbhash.BBHash  `json:"level"`
+	}
+	if err = json.Unmarshal([]byte(`{"hash":null,"level":null}`), &values); err != nil {
+		t.Errorf("json.Unmarshal() with null values failed: %v", err)
+	}
+
+	// A mismatched checksum must be rejected
+	bad := bytes.Replace(data, []byte(`"checksum":"`), []byte(`"checksum":"x`), 1)
+	if err = json.Unmarshal(bad, &out); err == nil {
+		t.Error("json.Unmarshal() with bad checksum should have failed")
+	}
+}
@@ -0,0 +1,431 @@
+// Package bbhashhttp provides an HTTP handler that serves lookups in one or more
+// named BBHash2 functions, so that services written in other languages can share
+// a single copy of the functions.
+//
+// The handler serves the following endpoints, where {name} is the name of a function:
+//
+//	GET  /{name}/find?key=K       index of key K
+//	POST /{name}/find             indices of the keys in a {"keys": [...]} request body
+//	GET  /{name}/key?index=I      key of index I (requires a reverse map; 404 if out of range)
+//	POST /{name}/key              keys of the indices in an {"indices": [...]} request body
+//	GET  /{name}/stats            statistics of the function
+//	GET  /stats                   statistics of all functions
+//
+// Keys and indices in query parameters may be decimal or have a 0x, 0o or 0b prefix.
+// Responses are JSON objects; errors are reported as {"error": "..."} with a 4xx status.
+//
+// Functions loaded from files with LoadFile can be reloaded with Reload, for example
+// on SIGHUP, or whenever their files change with Watch. Lookups in progress during
+// a reload complete using the previous version of the function. A function whose
+// file cannot be decoded keeps its previous version, so files should be replaced
+// atomically, for example by renaming a new file over the old one.
+package bbhashhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/relab/bbhash"
+)
+
+// maxBodyBytes is the maximum size of a batch request body.
+const maxBodyBytes = 32 << 20
+
+// Handler serves lookups in a set of named BBHash2 functions.
+// It is safe for concurrent use.
+type Handler struct {
+	// ErrorLog is used to log errors during Watch.
+	// If nil, errors are logged with the log package's standard logger.
+	ErrorLog *log.Logger
+
+	mux   *http.ServeMux
+	mu    sync.RWMutex
+	funcs map[string]*function
+}
+
+// function holds a loaded function and its statistics.
+// It is never modified after being added to the handler.
+type function struct {
+	bb      *bbhash.BBHash2
+	stats   Stats
+	modTime time.Time // modification time of the file when it was loaded
+}
+
+// Stats holds statistics of a function.
+type Stats struct {
+	Name       string    `json:"name"`
+	Keys       uint64    `json:"keys"`
+	Partitions int       `json:"partitions"`
+	MaxLevels  int       `json:"max_levels"`
+	BitsPerKey float64   `json:"bits_per_key"`
+	ReverseMap bool      `json:"reverse_map"`
+	Path       string    `json:"path,omitempty"` // file the function was loaded from, if any
+	Size       int64     `json:"size,omitempty"` // size of the file, if any
+	LoadedAt   time.Time `json:"loaded_at"`
+}
+
+// NewHandler returns a handler without any functions.
+func NewHandler() *Handler {
+	h := &Handler{
+		mux:   http.NewServeMux(),
+		funcs: make(map[string]*function),
+	}
+	h.mux.HandleFunc("GET /{name}/find", h.find)
+	h.mux.HandleFunc("POST /{name}/find", h.findBatch)
+	h.mux.HandleFunc("GET /{name}/key", h.key)
+	h.mux.HandleFunc("POST /{name}/key", h.keyBatch)
+	h.mux.HandleFunc("GET /{name}/stats", h.stats)
+	h.mux.HandleFunc("GET /stats", h.allStats)
+	return h
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// Set adds or replaces the function with the given name.
+func (h *Handler) Set(name string, bb *bbhash.BBHash2) {
+	h.set(name, newFunction(name, bb))
+}
+
+// Remove removes the function with the given name.
+func (h *Handler) Remove(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.funcs, name)
+}
+
+// Names returns the sorted names of the functions served by the handler.
+func (h *Handler) Names() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	names := make([]string, 0, len(h.funcs))
+	for name := range h.funcs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// LoadFile reads the serialized BBHash2 at path and adds or replaces the
+// function with the given name. The file may hold the default or the
+// indexed encoding; see BBHash2.UnmarshalBinary.
+func (h *Handler) LoadFile(name, path string) error {
+	fn, err := loadFile(name, path)
+	if err != nil {
+		return err
+	}
+	h.set(name, fn)
+	return nil
+}
+
+// Reload reloads all functions that were loaded from files.
+// If a function cannot be reloaded, the previous version is kept
+// and the error is included in the returned error.
+func (h *Handler) Reload() error {
+	return h.reload(func(*function, os.FileInfo) bool { return true })
+}
+
+// Watch checks the files of functions loaded with LoadFile every interval,
+// and reloads the functions whose files have changed. It returns when ctx is done.
+func (h *Handler) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := h.reload(func(fn *function, fi os.FileInfo) bool {
+				return !fi.ModTime().Equal(fn.modTime) || fi.Size() != fn.stats.Size
+			})
+			if err != nil {
+				h.logf("bbhashhttp: %v", err)
+			}
+		}
+	}
+}
+
+// reload reloads the functions loaded from files for which changed returns true.
+func (h *Handler) reload(changed func(*function, os.FileInfo) bool) error {
+	h.mu.RLock()
+	funcs := make(map[string]*function, len(h.funcs))
+	for name, fn := range h.funcs {
+		if fn.stats.Path != "" {
+			funcs[name] = fn
+		}
+	}
+	h.mu.RUnlock()
+
+	var errs []error
+	for name, fn := range funcs {
+		fi, err := os.Stat(fn.stats.Path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reloading %q: %w", name, err))
+			continue
+		}
+		if !changed(fn, fi) {
+			continue
+		}
+		newFn, err := loadFile(name, fn.stats.Path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reloading %q: %w", name, err))
+			continue
+		}
+		h.mu.Lock()
+		// Only replace the function if it was not replaced or removed in the meantime.
+		if h.funcs[name] == fn {
+			h.funcs[name] = newFn
+		}
+		h.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// set adds or replaces the function with the given name.
+func (h *Handler) set(name string, fn *function) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.funcs[name] = fn
+}
+
+// get returns the function with the given name, or nil if there is none.
+func (h *Handler) get(name string) *function {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.funcs[name]
+}
+
+// logf logs an error using the handler's error log.
+func (h *Handler) logf(format string, args ...any) {
+	if h.ErrorLog != nil {
+		h.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// loadFile reads the serialized BBHash2 at path.
+func loadFile(name, path string) (*function, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, fi.Size())
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	bb := &bbhash.BBHash2{}
+	if err := bb.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	fn := newFunction(name, bb)
+	fn.stats.Path = path
+	fn.stats.Size = fi.Size()
+	fn.modTime = fi.ModTime()
+	return fn, nil
+}
+
+// newFunction returns a function with the statistics of bb.
+func newFunction(name string, bb *bbhash.BBHash2) *function {
+	maxLevels, _ := bb.MaxMinLevels()
+	return &function{
+		bb: bb,
+		stats: Stats{
+			Name:       name,
+			Keys:       uint64(bb.Len()),
+			Partitions: bb.Partitions(),
+			MaxLevels:  maxLevels,
+			BitsPerKey: bb.BitsPerKey(),
+			ReverseMap: bb.HasReverseMap(),
+			LoadedAt:   time.Now(),
+		},
+	}
+}
+
+// lookup returns the function named in the request path, or writes an error and returns nil.
+func (h *Handler) lookup(w http.ResponseWriter, r *http.Request) *function {
+	name := r.PathValue("name")
+	fn := h.get(name)
+	if fn == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown function %q", name))
+	}
+	return fn
+}
+
+// reverseLookup returns the function named in the request path if it has a reverse map,
+// or writes an error and returns nil.
+func (h *Handler) reverseLookup(w http.ResponseWriter, r *http.Request) *function {
+	fn := h.lookup(w, r)
+	if fn != nil && !fn.stats.ReverseMap {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("function %q has no reverse map", fn.stats.Name))
+		return nil
+	}
+	return fn
+}
+
+type findResponse struct {
+	Key   uint64 `json:"key"`
+	Index uint64 `json:"index"`
+}
+
+type batchRequest struct {
+	Keys    []uint64 `json:"keys,omitempty"`
+	Indices []uint64 `json:"indices,omitempty"`
+}
+
+type batchResponse struct {
+	Keys    []uint64 `json:"keys"`
+	Indices []uint64 `json:"indices"`
+}
+
+func (h *Handler) find(w http.ResponseWriter, r *http.Request) {
+	fn := h.lookup(w, r)
+	if fn == nil {
+		return
+	}
+	key, ok := queryUint(w, r, "key")
+	if !ok {
+		return
+	}
+	writeJSON(w, findResponse{Key: key, Index: fn.bb.Find(key)})
+}
+
+func (h *Handler) findBatch(w http.ResponseWriter, r *http.Request) {
+	fn := h.lookup(w, r)
+	if fn == nil {
+		return
+	}
+	req, ok := readBatch(w, r)
+	if !ok {
+		return
+	}
+	indices := make([]uint64, len(req.Keys))
+	for i, key := range req.Keys {
+		indices[i] = fn.bb.Find(key)
+	}
+	writeJSON(w, batchResponse{Keys: req.Keys, Indices: indices})
+}
+
+func (h *Handler) key(w http.ResponseWriter, r *http.Request) {
+	fn := h.reverseLookup(w, r)
+	if fn == nil {
+		return
+	}
+	index, ok := queryUint(w, r, "index")
+	if !ok {
+		return
+	}
+	key, ok := fn.bb.LookupKey(index)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("index %d out of range", index))
+		return
+	}
+	writeJSON(w, findResponse{Key: key, Index: index})
+}
+
+func (h *Handler) keyBatch(w http.ResponseWriter, r *http.Request) {
+	fn := h.reverseLookup(w, r)
+	if fn == nil {
+		return
+	}
+	req, ok := readBatch(w, r)
+	if !ok {
+		return
+	}
+	keys := make([]uint64, len(req.Indices))
+	for i, index := range req.Indices {
+		key, ok := fn.bb.LookupKey(index)
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("index %d out of range", index))
+			return
+		}
+		keys[i] = key
+	}
+	writeJSON(w, batchResponse{Keys: keys, Indices: req.Indices})
+}
+
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	fn := h.lookup(w, r)
+	if fn == nil {
+		return
+	}
+	writeJSON(w, fn.stats)
+}
+
+func (h *Handler) allStats(w http.ResponseWriter, _ *http.Request) {
+	h.mu.RLock()
+	stats := make([]Stats, 0, len(h.funcs))
+	for _, fn := range h.funcs {
+		stats = append(stats, fn.stats)
+	}
+	h.mu.RUnlock()
+	slices.SortFunc(stats, func(a, b Stats) int { return strings.Compare(a.Name, b.Name) })
+	writeJSON(w, struct {
+		Functions []Stats `json:"functions"`
+	}{stats})
+}
+
+// queryUint parses the named query parameter, or writes an error and returns false.
+func queryUint(w http.ResponseWriter, r *http.Request, param string) (uint64, bool) {
+	s := r.URL.Query().Get(param)
+	if s == "" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("missing %s parameter", param))
+		return 0, false
+	}
+	v, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s %q", param, s))
+		return 0, false
+	}
+	return v, true
+}
+
+// readBatch decodes a batch request body, or writes an error and returns false.
+func readBatch(w http.ResponseWriter, r *http.Request) (*batchRequest, bool) {
+	req := &batchRequest{}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(req); err != nil {
+		status := http.StatusBadRequest
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeError(w, status, fmt.Sprintf("invalid request body: %v", err))
+		return nil, false
+	}
+	return req, true
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response with the given status code.
+func writeError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{msg})
+}
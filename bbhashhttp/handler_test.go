@@ -0,0 +1,275 @@
+package bbhashhttp_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/relab/bbhash"
+	"github.com/relab/bbhash/bbhashhttp"
+)
+
+func generateKeys(size, seed int) []uint64 {
+	keys := make([]uint64, size)
+	r := rand.New(rand.NewSource(int64(seed)))
+	for i := range keys {
+		keys[i] = r.Uint64()
+	}
+	return keys
+}
+
+// writeFunction writes the indexed encoding of a BBHash2 for keys to path.
+func writeFunction(t *testing.T, path string, keys []uint64, opts ...bbhash.Options) *bbhash.BBHash2 {
+	t.Helper()
+	bb, err := bbhash.New(keys, opts...)
+	if err != nil {
+		t.Fatalf("Failed to create BBHash2: %v", err)
+	}
+	data, err := bb.MarshalIndexed()
+	if err != nil {
+		t.Fatalf("Failed to marshal BBHash2: %v", err)
+	}
+	// Write to a temporary file and rename it, as a deployment would.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	return bb
+}
+
+// get sends a GET request to the server and decodes the JSON response into v.
+func get(t *testing.T, srv *httptest.Server, path string, v any) int {
+	t.Helper()
+	resp, err := srv.Client().Get(srv.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: invalid JSON response: %v", path, err)
+	}
+	return resp.StatusCode
+}
+
+// post sends a POST request with the JSON encoding of body and decodes the JSON response into v.
+func post(t *testing.T, srv *httptest.Server, path string, body, v any) int {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := srv.Client().Post(srv.URL+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("POST %s: invalid JSON response: %v", path, err)
+	}
+	return resp.StatusCode
+}
+
+type findResponse struct {
+	Key   uint64 `json:"key"`
+	Index uint64 `json:"index"`
+	Error string `json:"error"`
+}
+
+type batchResponse struct {
+	Keys    []uint64 `json:"keys"`
+	Indices []uint64 `json:"indices"`
+	Error   string   `json:"error"`
+}
+
+func TestHandler(t *testing.T) {
+	keys := generateKeys(10000, 99)
+	users, err := bbhash.New(keys, bbhash.Partitions(4), bbhash.WithReverseMap())
+	if err != nil {
+		t.Fatalf("Failed to create BBHash2: %v", err)
+	}
+	orders, err := bbhash.New(keys[:1000])
+	if err != nil {
+		t.Fatalf("Failed to create BBHash2: %v", err)
+	}
+	h := bbhashhttp.NewHandler()
+	h.Set("users", users)
+	h.Set("orders", orders)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	t.Run("find", func(t *testing.T) {
+		for _, key := range keys[:100] {
+			var got findResponse
+			if code := get(t, srv, fmt.Sprintf("/users/find?key=%d", key), &got); code != http.StatusOK {
+				t.Fatalf("GET /users/find = %d (%s), want %d", code, got.Error, http.StatusOK)
+			}
+			if want := users.Find(key); got.Key != key || got.Index != want {
+				t.Fatalf("GET /users/find = %+v, want {Key: %d, Index: %d}", got, key, want)
+			}
+		}
+		var got findResponse
+		get(t, srv, fmt.Sprintf("/users/find?key=%#x", keys[0]), &got)
+		if want := users.Find(keys[0]); got.Index != want {
+			t.Errorf("GET /users/find with hex key = %d, want %d", got.Index, want)
+		}
+	})
+
+	t.Run("find/batch", func(t *testing.T) {
+		var got batchResponse
+		if code := post(t, srv, "/orders/find", map[string]any{"keys": keys[:1000]}, &got); code != http.StatusOK {
+			t.Fatalf("POST /orders/find = %d (%s), want %d", code, got.Error, http.StatusOK)
+		}
+		if len(got.Indices) != 1000 {
+			t.Fatalf("POST /orders/find returned %d indices, want 1000", len(got.Indices))
+		}
+		for i, key := range keys[:1000] {
+			if want := orders.Find(key); got.Indices[i] != want {
+				t.Fatalf("POST /orders/find: index of %d = %d, want %d", key, got.Indices[i], want)
+			}
+		}
+	})
+
+	t.Run("key", func(t *testing.T) {
+		idx := users.Find(keys[42])
+		var got findResponse
+		if code := get(t, srv, fmt.Sprintf("/users/key?index=%d", idx), &got); code != http.StatusOK {
+			t.Fatalf("GET /users/key = %d (%s), want %d", code, got.Error, http.StatusOK)
+		}
+		if got.Key != keys[42] {
+			t.Errorf("GET /users/key?index=%d = %d, want %d", idx, got.Key, keys[42])
+		}
+
+		var batch batchResponse
+		indices := []uint64{users.Find(keys[1]), users.Find(keys[2])}
+		if code := post(t, srv, "/users/key", map[string]any{"indices": indices}, &batch); code != http.StatusOK {
+			t.Fatalf("POST /users/key = %d (%s), want %d", code, batch.Error, http.StatusOK)
+		}
+		if len(batch.Keys) != 2 || batch.Keys[0] != keys[1] || batch.Keys[1] != keys[2] {
+			t.Errorf("POST /users/key = %v, want %v", batch.Keys, keys[1:3])
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		var got bbhashhttp.Stats
+		if code := get(t, srv, "/users/stats", &got); code != http.StatusOK {
+			t.Fatalf("GET /users/stats = %d, want %d", code, http.StatusOK)
+		}
+		if got.Name != "users" || got.Keys != 10000 || got.Partitions != 4 || !got.ReverseMap {
+			t.Errorf("GET /users/stats = %+v, want users with 10000 keys, 4 partitions and a reverse map", got)
+		}
+		var all struct {
+			Functions []bbhashhttp.Stats `json:"functions"`
+		}
+		get(t, srv, "/stats", &all)
+		if len(all.Functions) != 2 || all.Functions[0].Name != "orders" || all.Functions[1].Name != "users" {
+			t.Errorf("GET /stats = %+v, want orders and users", all.Functions)
+		}
+	})
+
+	errorTests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{name: "unknown function", method: "GET", path: "/products/find?key=1", code: http.StatusNotFound},
+		{name: "missing key", method: "GET", path: "/users/find", code: http.StatusBadRequest},
+		{name: "invalid key", method: "GET", path: "/users/find?key=abc", code: http.StatusBadRequest},
+		{name: "no reverse map", method: "GET", path: "/orders/key?index=1", code: http.StatusNotFound},
+		{name: "no reverse map/batch", method: "POST", path: "/orders/key", body: `{"indices":[1]}`, code: http.StatusNotFound},
+		{name: "index out of range", method: "GET", path: "/users/key?index=0", code: http.StatusNotFound},
+		{name: "index out of range/batch", method: "POST", path: "/users/key", body: `{"indices":[1,0]}`, code: http.StatusBadRequest},
+		{name: "invalid body", method: "POST", path: "/users/find", body: `{"keys":["a"]}`, code: http.StatusBadRequest},
+		{name: "unknown field", method: "POST", path: "/users/find", body: `{"key":[1]}`, code: http.StatusBadRequest},
+	}
+	for _, tt := range errorTests {
+		t.Run("error/"+tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.code {
+				t.Errorf("%s %s = %d, want %d", tt.method, tt.path, rec.Code, tt.code)
+			}
+			var got findResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Error == "" {
+				t.Errorf("%s %s: response %q lacks error message", tt.method, tt.path, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "users.bbhash")
+	keys := generateKeys(5000, 99)
+	writeFunction(t, path, keys[:1000])
+
+	h := bbhashhttp.NewHandler()
+	if err := h.LoadFile("users", path); err != nil {
+		t.Fatalf("LoadFile() failed: %v", err)
+	}
+	if err := h.LoadFile("missing", filepath.Join(dir, "missing.bbhash")); err == nil {
+		t.Error("LoadFile() of missing file should have failed")
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	statsKeys := func() uint64 {
+		var got bbhashhttp.Stats
+		get(t, srv, "/users/stats", &got)
+		return got.Keys
+	}
+	if got := statsKeys(); got != 1000 {
+		t.Fatalf("Keys = %d, want 1000", got)
+	}
+
+	// Reload picks up the new file
+	bb := writeFunction(t, path, keys[:2000], bbhash.WithReverseMap())
+	if err := h.Reload(); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if got := statsKeys(); got != 2000 {
+		t.Fatalf("Keys after Reload = %d, want 2000", got)
+	}
+	var got findResponse
+	get(t, srv, fmt.Sprintf("/users/key?index=%d", bb.Find(keys[7])), &got)
+	if got.Key != keys[7] {
+		t.Errorf("GET /users/key after Reload = %d, want %d", got.Key, keys[7])
+	}
+
+	// A corrupt file is not loaded; the previous version is kept
+	if err := os.WriteFile(path, []byte{1, 2, 3}, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Reload(); err == nil {
+		t.Error("Reload() of corrupt file should have failed")
+	}
+	if got := statsKeys(); got != 2000 {
+		t.Fatalf("Keys after failed Reload = %d, want 2000", got)
+	}
+
+	// Watch picks up file changes
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Watch(ctx, 10*time.Millisecond)
+	writeFunction(t, path, keys[:3000])
+	deadline := time.Now().Add(5 * time.Second)
+	for statsKeys() != 3000 {
+		if time.Now().After(deadline) {
+			t.Fatal("Watch did not reload the changed file")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -55,6 +55,17 @@ func (b bitVector) onesCount() uint64 {
 	return uint64(p)
 }
 
+// wordRanks returns the rank of the first bit of each word in the bit vector,
+// that is, the number of one bits in the preceding words plus the given rank.
+func (b bitVector) wordRanks(rank uint64) []uint64 {
+	ranks := make([]uint64, len(b))
+	for i, v := range b {
+		ranks[i] = rank
+		rank += uint64(bits.OnesCount64(v))
+	}
+	return ranks
+}
+
 // rank returns the number of one bits in the bit vector up to position i.
 func (b bitVector) rank(i uint64) uint64 {
 	x := i / 64
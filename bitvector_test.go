@@ -49,6 +49,26 @@ func TestSetIsSet(t *testing.T) {
 	}
 }
 
+func TestWordRanks(t *testing.T) {
+	const words = 10
+	bv := make(bitVector, words)
+	for i := uint64(0); i < bv.size(); i += 3 {
+		bv.set(i)
+	}
+	const start = 7
+	ranks := bv.wordRanks(start)
+	if len(ranks) != words {
+		t.Fatalf("len(wordRanks) = %d, expected %d", len(ranks), words)
+	}
+	for x := range ranks {
+		// the rank of a word's first bit is the number of one bits before it
+		want := start + bv.rank(uint64(x)*64)
+		if ranks[x] != want {
+			t.Errorf("wordRanks[%d] = %d, expected %d", x, ranks[x], want)
+		}
+	}
+}
+
 func TestBitVectorMarshalUnmarshalBinary(t *testing.T) {
 	for _, words := range []uint64{1, 10, 100, 1000, 10000, 100000} {
 		t.Run(fmt.Sprintf("words=%d", words), func(t *testing.T) {
@@ -0,0 +1,184 @@
+// Command bbdedup builds chunk deduplication indexes and queries them.
+//
+// Usage:
+//
+//	bbdedup build [flags] -o <index> <file or directory> ...
+//	bbdedup query [flags] -index <index> <file> ...
+//
+// The build command splits the given files, and the files in the given directories,
+// into chunks and writes an index of the unique chunks; see package dedup.
+// The query command splits each file into chunks the same way, and reports
+// which of its chunks already exist in the indexed files.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/relab/bbhash"
+	"github.com/relab/bbhash/dedup"
+)
+
+// errUsage is returned by commands to signal that usage information was printed.
+var errUsage = errors.New("usage")
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("bbdedup: ")
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		if errors.Is(err, errUsage) {
+			os.Exit(2)
+		}
+		log.Fatal(err)
+	}
+}
+
+// run runs the subcommand given by args[0] with the remaining arguments.
+func run(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return usage()
+	}
+	switch args[0] {
+	case "build":
+		return build(args[1:], stdout)
+	case "query":
+		return query(args[1:], stdout)
+	}
+	fmt.Fprintf(os.Stderr, "bbdedup: unknown command %q\n", args[0])
+	return usage()
+}
+
+func usage() error {
+	fmt.Fprintln(os.Stderr, "usage: bbdedup build [flags] -o <index> <file or directory> ...")
+	fmt.Fprintln(os.Stderr, "       bbdedup query [flags] -index <index> <file> ...")
+	fmt.Fprintln(os.Stderr, `Run "bbdedup <command> -h" for the flags of each command.`)
+	return errUsage
+}
+
+// build chunks the given files and writes an index of the unique chunks.
+func build(args []string, stdout io.Writer) error {
+	fset := flag.NewFlagSet("build", flag.ContinueOnError)
+	var (
+		output     = fset.String("o", "", "index file (required)")
+		minSize    = fset.Int("min", 2048, "minimum chunk size of content-defined chunking")
+		avgSize    = fset.Int("avg", 8192, "average chunk size of content-defined chunking")
+		maxSize    = fset.Int("max", 65536, "maximum chunk size of content-defined chunking")
+		fixedSize  = fset.Int("fixed", 0, "use fixed-size chunks of this size instead of content-defined chunking")
+		hash       = fset.String("hash", "sha256", "chunk hash function (sha256 or fast)")
+		gamma      = fset.Float64("gamma", 2.0, "gamma parameter")
+		partitions = fset.Int("partitions", 1, "number of partitions")
+	)
+	if err := fset.Parse(args); err != nil {
+		return errUsage
+	}
+	if *output == "" || fset.NArg() == 0 {
+		fset.Usage()
+		return errUsage
+	}
+
+	opts := []dedup.Options{dedup.ContentDefined(*minSize, *avgSize, *maxSize)}
+	if *fixedSize != 0 {
+		opts = append(opts, dedup.FixedSize(*fixedSize))
+	}
+	switch *hash {
+	case "sha256":
+		opts = append(opts, dedup.Hash(dedup.SHA256))
+	case "fast":
+		opts = append(opts, dedup.Hash(dedup.FastHash))
+	default:
+		return fmt.Errorf("unknown hash function %q", *hash)
+	}
+	b, err := dedup.NewBuilder(opts...)
+	if err != nil {
+		return err
+	}
+	for _, root := range fset.Args() {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			return b.AddFile(path)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	ix, err := b.Build(bbhash.Gamma(*gamma), bbhash.Partitions(*partitions))
+	if err != nil {
+		return err
+	}
+	if err := ix.WriteFile(*output); err != nil {
+		return err
+	}
+	s := b.Stats()
+	fmt.Fprintf(stdout, "%d files, %d chunks (%d bytes), %d unique chunks (%d bytes), %.1f%% duplicate bytes\n",
+		s.Files, s.Chunks, s.Bytes, s.UniqueChunks, s.UniqueBytes, 100*float64(s.Bytes-s.UniqueBytes)/float64(max(s.Bytes, 1)))
+	return nil
+}
+
+// query reports the chunks of each file that already exist in the index.
+func query(args []string, stdout io.Writer) error {
+	fset := flag.NewFlagSet("query", flag.ContinueOnError)
+	var (
+		index   = fset.String("index", "", "index file (required)")
+		verbose = fset.Bool("v", false, "print every chunk, not only a summary per file")
+	)
+	if err := fset.Parse(args); err != nil {
+		return errUsage
+	}
+	if *index == "" || fset.NArg() == 0 {
+		fset.Usage()
+		return errUsage
+	}
+	ix, err := dedup.ReadFile(*index)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, path := range fset.Args() {
+		if err := queryFile(ix, path, *verbose, stdout); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// queryFile prints the chunks of the file at path that exist in the index.
+func queryFile(ix *dedup.Index, path string, verbose bool, stdout io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var chunks, found, bytes, foundBytes int
+	for m, err := range ix.Query(f) {
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		chunks++
+		bytes += m.Length
+		if m.Found {
+			found++
+			foundBytes += m.Length
+		}
+		if !verbose {
+			continue
+		}
+		if m.Found {
+			loc := m.Location
+			fmt.Fprintf(stdout, "%s\t%d\t%d\t%016x\t%s\t%d\n", path, m.Offset, m.Length, m.Hash, ix.Files[loc.File], loc.Offset)
+		} else {
+			fmt.Fprintf(stdout, "%s\t%d\t%d\t%016x\t-\n", path, m.Offset, m.Length, m.Hash)
+		}
+	}
+	fmt.Fprintf(stdout, "%s: %d of %d chunks (%d of %d bytes) already exist\n", path, found, chunks, foundBytes, bytes)
+	return nil
+}
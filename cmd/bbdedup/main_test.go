@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func randomData(size, seed int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(seed))).Read(data)
+	return data
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildQuery(t *testing.T) {
+	dir := t.TempDir()
+	a := randomData(1<<18, 1)
+	b := slices.Concat(a[:1<<17], randomData(1<<17, 2)) // first half shared with a
+	c := slices.Concat(randomData(1<<16, 3), a[1<<16:]) // all but the first quarter shared with a
+	writeFile(t, filepath.Join(dir, "files", "a"), a)
+	writeFile(t, filepath.Join(dir, "files", "sub", "b"), b)
+	newFile := filepath.Join(dir, "c")
+	writeFile(t, newFile, c)
+
+	tests := []struct {
+		name  string
+		flags []string
+	}{
+		{name: "ContentDefined", flags: []string{"-min", "512", "-avg", "2048", "-max", "8192"}},
+		{name: "FixedSize/FastHash", flags: []string{"-fixed", "4096", "-hash", "fast", "-partitions", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := filepath.Join(t.TempDir(), "files.bbdx")
+			var out bytes.Buffer
+			args := slices.Concat([]string{"build", "-o", index}, tt.flags, []string{filepath.Join(dir, "files")})
+			if err := run(args, &out); err != nil {
+				t.Fatalf("build failed: %v", err)
+			}
+			if !strings.HasPrefix(out.String(), "2 files, ") {
+				t.Errorf("build output = %q, want prefix %q", out.String(), "2 files, ")
+			}
+
+			out.Reset()
+			if err := run([]string{"query", "-index", index, "-v", newFile}, &out); err != nil {
+				t.Fatalf("query failed: %v", err)
+			}
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			summary := lines[len(lines)-1]
+			if !strings.HasPrefix(summary, newFile+": ") || !strings.HasSuffix(summary, "already exist") {
+				t.Errorf("query summary = %q, want %s: ... already exist", summary, newFile)
+			}
+
+			// Restore the queried file from the reported chunks: found chunks are
+			// read from the indexed files, and the others are taken from the file.
+			var restored []byte
+			var foundBytes int
+			for _, line := range lines[:len(lines)-1] {
+				fields := strings.Split(line, "\t")
+				if len(fields) < 5 || fields[0] != newFile {
+					t.Fatalf("malformed chunk line %q", line)
+				}
+				offset, _ := strconv.Atoi(fields[1])
+				length, _ := strconv.Atoi(fields[2])
+				if offset != len(restored) {
+					t.Fatalf("chunk at %d, want %d", offset, len(restored))
+				}
+				chunk := c[offset : offset+length]
+				if fields[4] != "-" {
+					data, err := os.ReadFile(fields[4])
+					if err != nil {
+						t.Fatal(err)
+					}
+					locOffset, _ := strconv.Atoi(fields[5])
+					chunk = data[locOffset : locOffset+length]
+					foundBytes += length
+				}
+				restored = append(restored, chunk...)
+			}
+			if !bytes.Equal(restored, c) {
+				t.Error("file restored from the reported chunks differs from the original")
+			}
+			if foundBytes < len(c)/2 {
+				t.Errorf("query found %d of %d bytes, want at least half", foundBytes, len(c))
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "files", "a")
+	writeFile(t, file, randomData(1<<16, 1))
+	writeFile(t, filepath.Join(dir, "corrupt.bbdx"), []byte("BBDX\x01"))
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	index := filepath.Join(dir, "files.bbdx")
+	if err := run([]string{"build", "-o", index, filepath.Join(dir, "files")}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantUsage bool
+	}{
+		{name: "NoCommand", args: nil, wantUsage: true},
+		{name: "UnknownCommand", args: []string{"restore"}, wantUsage: true},
+		{name: "Build/NoOutput", args: []string{"build", file}, wantUsage: true},
+		{name: "Build/NoFiles", args: []string{"build", "-o", filepath.Join(dir, "x.bbdx")}, wantUsage: true},
+		{name: "Build/UnknownFlag", args: []string{"build", "-unknown", "-o", filepath.Join(dir, "x.bbdx"), file}, wantUsage: true},
+		{name: "Build/UnknownHash", args: []string{"build", "-hash", "md5", "-o", filepath.Join(dir, "x.bbdx"), file}},
+		{name: "Build/InvalidSizes", args: []string{"build", "-min", "4096", "-avg", "1024", "-o", filepath.Join(dir, "x.bbdx"), file}},
+		{name: "Build/MissingFile", args: []string{"build", "-o", filepath.Join(dir, "x.bbdx"), filepath.Join(dir, "missing")}},
+		{name: "Build/NoChunks", args: []string{"build", "-o", filepath.Join(dir, "x.bbdx"), filepath.Join(dir, "empty")}},
+		{name: "Query/NoIndex", args: []string{"query", file}, wantUsage: true},
+		{name: "Query/MissingIndex", args: []string{"query", "-index", filepath.Join(dir, "missing.bbdx"), file}},
+		{name: "Query/CorruptIndex", args: []string{"query", "-index", filepath.Join(dir, "corrupt.bbdx"), file}},
+		{name: "Query/MissingFile", args: []string{"query", "-index", index, filepath.Join(dir, "missing")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := run(tt.args, &bytes.Buffer{})
+			if err == nil {
+				t.Fatalf("run(%q) succeeded, want error", tt.args)
+			}
+			if errors.Is(err, errUsage) != tt.wantUsage {
+				t.Errorf("run(%q) = %v, want usage error %t", tt.args, err, tt.wantUsage)
+			}
+		})
+	}
+
+	// A missing file does not stop the query of the other files
+	var out bytes.Buffer
+	err := run([]string{"query", "-index", index, filepath.Join(dir, "missing"), file}, &out)
+	if err == nil {
+		t.Error("query of a missing file succeeded, want error")
+	}
+	if want := fmt.Sprintf("%s: ", file); !strings.Contains(out.String(), want) {
+		t.Errorf("query output = %q, want summary for %s", out.String(), file)
+	}
+}
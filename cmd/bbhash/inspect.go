@@ -0,0 +1,290 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+
+	"github.com/relab/bbhash"
+)
+
+// report describes a serialized BBHash or BBHash2.
+type report struct {
+	File       string            `json:"file"`
+	Type       string            `json:"type"`              // BBHash or BBHash2
+	Encoding   string            `json:"encoding"`          // default or indexed
+	Version    int               `json:"version,omitempty"` // version of the indexed encoding
+	Envelope   *envelopeReport   `json:"envelope,omitempty"`
+	Signature  *signatureReport  `json:"signature,omitempty"`
+	ReverseMap bool              `json:"reverse_map"`
+	Compressed bool              `json:"reverse_map_compressed,omitempty"`
+	Keys       uint64            `json:"keys"`
+	BitsPerKey float64           `json:"bits_per_key"`
+	Size       sizeReport        `json:"size"`
+	Partitions []partitionReport `json:"partitions"`
+}
+
+// envelopeReport describes the text or JSON envelope of a file.
+type envelopeReport struct {
+	Format        string `json:"format"` // text or json
+	Version       int    `json:"version"`
+	Keys          uint64 `json:"keys"`
+	Checksum      string `json:"checksum"`
+	ChecksumValid bool   `json:"checksum_valid"`
+}
+
+// signatureReport describes the embedded signature of a file.
+type signatureReport struct {
+	Status string `json:"status"` // valid, invalid or unverified
+}
+
+// sizeReport holds the number of bytes used by each part of a file.
+type sizeReport struct {
+	Total      int `json:"total"`
+	Envelope   int `json:"envelope"`    // text, JSON or signature envelope
+	Header     int `json:"header"`      // encoding header, including the partition count
+	Index      int `json:"index"`       // partition index of the indexed encoding
+	BitVectors int `json:"bit_vectors"` // level counts, word counts and bit vectors
+	ReverseMap int `json:"reverse_map"`
+	Offsets    int `json:"offsets"` // partition key offsets of the default encoding
+}
+
+// partitionReport describes a partition of a BBHash2.
+type partitionReport struct {
+	Partition int           `json:"partition"`
+	Offset    uint64        `json:"offset"`
+	Keys      uint64        `json:"keys"`
+	Bytes     int           `json:"bytes"`
+	Levels    []levelReport `json:"levels"`
+}
+
+// levelReport describes the occupancy of a level's bit vector.
+type levelReport struct {
+	Level     int     `json:"level"`
+	Bits      int     `json:"bits"`
+	Ones      uint64  `json:"ones"`
+	Occupancy float64 `json:"occupancy"`
+}
+
+// inspected holds a decoded file and its report.
+type inspected struct {
+	report  *report
+	vectors [][][]uint64 // per-partition, per-level bit vectors
+}
+
+// inspect prints a JSON description of a serialized BBHash or BBHash2.
+func inspect(args []string, stdout io.Writer) error {
+	fs := newFlagSet("inspect", "[flags] <file>")
+	var (
+		typ    = fs.String("type", "BBHash2", "type of a binary encoding (BBHash or BBHash2); envelopes record the type")
+		pubKey = fs.String("pubkey", "", "hex-encoded ed25519 public key to verify signed files")
+	)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	in, err := inspectFile(fs.Arg(0), *typ, *pubKey)
+	if err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(in.report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(stdout, "%s\n", out); err != nil {
+		return err
+	}
+	if env := in.report.Envelope; env != nil && !env.ChecksumValid {
+		return fmt.Errorf("%s: checksum mismatch", fs.Arg(0))
+	}
+	if sig := in.report.Signature; sig != nil && sig.Status == "invalid" {
+		return fmt.Errorf("%s: invalid signature", fs.Arg(0))
+	}
+	return nil
+}
+
+// errDiffer is returned by diff when the files differ.
+var errDiffer = errors.New("files differ")
+
+// diff reports the partitions and levels that differ between two files.
+func diff(args []string, stdout io.Writer) error {
+	fs := newFlagSet("diff", "[flags] <file1> <file2>")
+	typ := fs.String("type", "BBHash2", "type of a binary encoding (BBHash or BBHash2); envelopes record the type")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errUsage
+	}
+	a, err := inspectFile(fs.Arg(0), *typ, "")
+	if err != nil {
+		return err
+	}
+	b, err := inspectFile(fs.Arg(1), *typ, "")
+	if err != nil {
+		return err
+	}
+
+	differ := false
+	printf := func(format string, args ...any) {
+		fmt.Fprintf(stdout, format+"\n", args...)
+		differ = true
+	}
+	ra, rb := a.report, b.report
+	if ra.Type != rb.Type {
+		printf("type: %s != %s", ra.Type, rb.Type)
+	}
+	if ra.Encoding != rb.Encoding || ra.Version != rb.Version {
+		printf("encoding: %s (version %d) != %s (version %d)", ra.Encoding, ra.Version, rb.Encoding, rb.Version)
+	}
+	if ra.ReverseMap != rb.ReverseMap {
+		printf("reverse map: %t != %t", ra.ReverseMap, rb.ReverseMap)
+	}
+	if ra.Compressed != rb.Compressed {
+		printf("compressed reverse map: %t != %t", ra.Compressed, rb.Compressed)
+	}
+	if ra.Keys != rb.Keys {
+		printf("keys: %d != %d", ra.Keys, rb.Keys)
+	}
+	if len(ra.Partitions) != len(rb.Partitions) {
+		printf("partitions: %d != %d", len(ra.Partitions), len(rb.Partitions))
+	}
+	for p := range min(len(ra.Partitions), len(rb.Partitions)) {
+		pa, pb := ra.Partitions[p], rb.Partitions[p]
+		if pa.Offset != pb.Offset {
+			printf("partition %d: offset %d != %d", p, pa.Offset, pb.Offset)
+		}
+		if pa.Keys != pb.Keys {
+			printf("partition %d: keys %d != %d", p, pa.Keys, pb.Keys)
+		}
+		if len(pa.Levels) != len(pb.Levels) {
+			printf("partition %d: levels %d != %d", p, len(pa.Levels), len(pb.Levels))
+		}
+		for lvl := range min(len(pa.Levels), len(pb.Levels)) {
+			va, vb := a.vectors[p][lvl], b.vectors[p][lvl]
+			if len(va) != len(vb) {
+				printf("partition %d level %d: bits %d != %d", p, lvl, 64*len(va), 64*len(vb))
+				continue
+			}
+			words := 0
+			for w := range va {
+				if va[w] != vb[w] {
+					words++
+				}
+			}
+			if words > 0 {
+				printf("partition %d level %d: %d of %d words differ (ones %d != %d)",
+					p, lvl, words, len(va), pa.Levels[lvl].Ones, pb.Levels[lvl].Ones)
+			}
+		}
+	}
+	if differ {
+		return errDiffer
+	}
+	return nil
+}
+
+// inspectFile decodes the file at path and describes it. The type of a binary encoding
+// is given by typ, and signed files are verified if pubKey is non-empty.
+func inspectFile(path, typ, pubKey string) (*inspected, error) {
+	inspectFn := bbhash.Inspect
+	switch typ {
+	case "BBHash":
+		inspectFn = bbhash.InspectBBHash
+	case "BBHash2":
+	default:
+		return nil, fmt.Errorf("unknown type %q", typ)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	in, err := inspectFn(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r := &report{
+		File:       path,
+		Type:       in.Type,
+		Encoding:   in.Encoding,
+		Version:    in.Version,
+		ReverseMap: in.ReverseMap,
+		Compressed: in.CompressedReverseMap,
+	}
+	if env := in.Envelope; env != nil {
+		r.Envelope = &envelopeReport{
+			Format:        env.Format,
+			Version:       env.Version,
+			Keys:          env.Keys,
+			Checksum:      env.Checksum,
+			ChecksumValid: env.ChecksumValid,
+		}
+	}
+	if sig := in.Signature; sig != nil {
+		r.Signature = &signatureReport{Status: "unverified"}
+		if pubKey != "" {
+			key, err := hex.DecodeString(pubKey)
+			if err != nil || len(key) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("invalid public key %q", pubKey)
+			}
+			r.Signature.Status = "invalid"
+			if sig.Verify(key) {
+				r.Signature.Status = "valid"
+			}
+		}
+	}
+	r.Size = sizeReport{
+		Total:    len(data),
+		Envelope: len(data) - len(in.Payload),
+		Header:   in.HeaderLength,
+		Index:    in.IndexLength,
+		Offsets:  in.OffsetsLength,
+	}
+
+	var vectors [][][]uint64
+	if in.Type == "BBHash" {
+		bb := &bbhash.BBHash{}
+		if err := bb.UnmarshalBinary(in.Payload); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		r.BitsPerKey = bb.BitsPerKey()
+		vectors = [][][]uint64{bb.LevelVectors()}
+	} else {
+		bb := &bbhash.BBHash2{}
+		if err := bb.UnmarshalBinary(in.Payload); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		r.BitsPerKey = bb.BitsPerKey()
+		vectors = bb.LevelVectors()
+	}
+
+	for p, part := range in.Partitions {
+		pr := partitionReport{Partition: p, Offset: part.Offset, Bytes: part.Length}
+		for lvl, bv := range vectors[p] {
+			var ones uint64
+			for _, w := range bv {
+				ones += uint64(bits.OnesCount64(w))
+			}
+			lr := levelReport{Level: lvl, Bits: 64 * len(bv), Ones: ones}
+			if lr.Bits > 0 {
+				lr.Occupancy = float64(ones) / float64(lr.Bits)
+			}
+			pr.Levels = append(pr.Levels, lr)
+			pr.Keys += ones
+		}
+		r.Size.BitVectors += part.Length - part.ReverseMapLength
+		r.Size.ReverseMap += part.ReverseMapLength
+		r.Keys += pr.Keys
+		r.Partitions = append(r.Partitions, pr)
+	}
+	return &inspected{report: r, vectors: vectors}, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/relab/bbhash"
+	"github.com/relab/bbhash/keysource"
+)
+
+// keyFormats describes the supported key formats.
+const keyFormats = `key format:
+  text    one unsigned integer per line, in decimal or with a 0x, 0o or 0b prefix
+  hex     one hexadecimal unsigned integer per line, with or without a 0x prefix
+  binary  raw little-endian uint64 values
+  string  one string per line, hashed with bbhash.FastHashFunc`
+
+// parseKey parses a single key in the given format.
+// The binary format has no text representation and is not supported.
+func parseKey(format, s string) (uint64, error) {
+	switch format {
+	case "text":
+		return strconv.ParseUint(s, 0, 64)
+	case "hex":
+		s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+		return strconv.ParseUint(s, 16, 64)
+	case "string":
+		return bbhash.FastHashFunc([]byte(s)), nil
+	case "binary":
+		return 0, errors.New("binary keys cannot be given as arguments")
+	}
+	return 0, fmt.Errorf("unknown key format %q", format)
+}
+
+// readKeyFile reads unique keys in the given format from path; "-" reads from stdin.
+func readKeyFile(path, format string) ([]uint64, error) {
+	if path == "-" {
+		return readKeys(os.Stdin, "<stdin>", format)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readKeys(f, path, format)
+}
+
+// readKeys reads unique keys in the given format from r. The name is used in error messages.
+//
+// For the text and hex formats, surrounding whitespace is ignored, as are empty lines
+// and lines starting with #. For the string format, each line is a key as is.
+func readKeys(r io.Reader, name, format string) ([]uint64, error) {
+	var src *keysource.Source[uint64]
+	switch format {
+	case "text":
+		src = keysource.Parse(r, func(s string) (uint64, error) { return parseKey(format, s) })
+	case "hex":
+		src = keysource.Hex(r)
+	case "binary":
+		src = keysource.Binary(r)
+	case "string":
+		src = keysource.HashedLines(r, bbhash.FastHashFunc)
+	default:
+		return nil, fmt.Errorf("unknown key format %q", format)
+	}
+
+	var keys []uint64
+	seen := make(map[uint64]int)
+	for key := range src.All() {
+		if prev, ok := seen[key]; ok {
+			return nil, fmt.Errorf("%s: duplicate key %d (keys %d and %d)", name, key, prev+1, len(keys)+1)
+		}
+		seen[key] = len(keys)
+		keys = append(keys, key)
+	}
+	if err := src.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no keys", name)
+	}
+	return keys, nil
+}
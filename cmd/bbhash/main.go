@@ -0,0 +1,308 @@
+// Command bbhash builds, queries and verifies minimal perfect hash functions.
+//
+// Usage:
+//
+//	bbhash build  [flags] -keys <file> -o <file>
+//	bbhash query  [flags] -f <file> [key ...]
+//	bbhash verify [flags] -f <file> -keys <file>
+//	bbhash inspect [flags] <file>
+//	bbhash diff [flags] <file1> <file2>
+//	bbhash values [flags] -f <file> -records <file> -width <n> -o <file>
+//
+// The build command reads a set of keys and writes the serialized BBHash2 to a file.
+// The query command prints the index of each key given as an argument or in a key file.
+// The verify command checks that the keys in a key file map bijectively onto [1, n],
+// where n is the number of keys.
+// The inspect command prints a JSON description of a serialized BBHash or BBHash2,
+// including its header fields, per-partition and per-level occupancy, size breakdown,
+// and the validity of its checksum or signature, if any.
+// The diff command reports the partitions and levels that differ between two files,
+// and exits with status 1 if they differ.
+// The values command reads a file of (key, value) records with fixed-width values
+// and writes the values in index order, so that the value of a key is at offset
+// (Find(key)-1)*width, using temporary bucket files to stay within a memory budget.
+//
+// Keys may be given as text (decimal or prefixed integers), hexadecimal integers,
+// raw little-endian uint64 values, or arbitrary strings that are hashed to keys;
+// see the -format flag. Key files may be "-" to read from stdin.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/relab/bbhash"
+)
+
+// commands maps subcommand names to their implementations.
+var commands = map[string]func(args []string, stdout io.Writer) error{
+	"build":   build,
+	"diff":    diff,
+	"inspect": inspect,
+	"query":   query,
+	"values":  values,
+	"verify":  verify,
+}
+
+// errUsage is returned by commands to signal that usage information was printed.
+var errUsage = errors.New("usage")
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("bbhash: ")
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		switch {
+		case errors.Is(err, errUsage):
+			os.Exit(2)
+		case errors.Is(err, errDiffer):
+			os.Exit(1)
+		}
+		log.Fatal(err)
+	}
+}
+
+// run runs the subcommand given by args[0] with the remaining arguments.
+func run(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return usage()
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "bbhash: unknown command %q\n", args[0])
+		return usage()
+	}
+	return cmd(args[1:], stdout)
+}
+
+// usage prints the list of subcommands.
+func usage() error {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	fmt.Fprintln(os.Stderr, "usage: bbhash <command> [flags]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", name)
+	}
+	fmt.Fprintln(os.Stderr, `Run "bbhash <command> -h" for the flags of each command.`)
+	return errUsage
+}
+
+// newFlagSet returns a flag set for the named command that documents the key formats.
+func newFlagSet(name, synopsis string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: bbhash %s %s\n", name, synopsis)
+		fs.PrintDefaults()
+		fmt.Fprintln(fs.Output(), keyFormats)
+	}
+	return fs
+}
+
+// parseFlags parses args, converting help and parse errors to errUsage.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	return nil
+}
+
+// build reads keys and writes the serialized BBHash2.
+func build(args []string, _ io.Writer) error {
+	fs := newFlagSet("build", "[flags] -keys <file> -o <file>")
+	var (
+		keyFile    = fs.String("keys", "", `key file (required; "-" for stdin)`)
+		format     = fs.String("format", "text", "key format (text, hex, binary or string)")
+		output     = fs.String("o", "", `output file (required; "-" for stdout)`)
+		gamma      = fs.Float64("gamma", 2.0, "gamma parameter")
+		partitions = fs.Int("partitions", 1, "number of partitions")
+		parallel   = fs.Bool("parallel", false, "shard the keys across multiple goroutines (not compatible with -partitions)")
+		reverseMap = fs.Bool("reverse-map", false, "create and store a reverse map from index to key (implies -indexed)")
+		compressed = fs.Bool("compress-reverse-map", false, "compress the reverse map, which saves space for clustered keys (implies -reverse-map)")
+		indexed    = fs.Bool("indexed", false, "write the indexed encoding, which allows lazy loading of partitions")
+	)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *keyFile == "" || *output == "" {
+		fs.Usage()
+		return errUsage
+	}
+	*reverseMap = *reverseMap || *compressed
+	if *parallel && (*partitions > 1 || *reverseMap) {
+		return errors.New("-parallel cannot be combined with -partitions or -reverse-map")
+	}
+
+	keys, err := readKeyFile(*keyFile, *format)
+	if err != nil {
+		return err
+	}
+	opts := []bbhash.Options{bbhash.Gamma(*gamma), bbhash.Partitions(*partitions)}
+	if *parallel {
+		opts = append(opts, bbhash.Parallel())
+	}
+	switch {
+	case *compressed:
+		opts = append(opts, bbhash.WithCompressedReverseMap())
+	case *reverseMap:
+		opts = append(opts, bbhash.WithReverseMap())
+	}
+	bb, err := bbhash.New(keys, opts...)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if *indexed || *reverseMap {
+		data, err = bb.MarshalIndexed()
+	} else {
+		data, err = bb.MarshalBinary()
+	}
+	if err != nil {
+		return err
+	}
+	if *output == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*output, data, 0o666); err != nil {
+		return err
+	}
+	log.Printf("wrote %d keys to %s (%d bytes)", len(keys), *output, len(data))
+	return nil
+}
+
+// query prints the index of each key, or the key of each index with -index.
+func query(args []string, stdout io.Writer) error {
+	fs := newFlagSet("query", "[flags] -f <file> [key ...]")
+	var (
+		file    = fs.String("f", "", "serialized BBHash2 file (required)")
+		keyFile = fs.String("keys", "", `key file to query in addition to the arguments ("-" for stdin)`)
+		format  = fs.String("format", "text", "key format (text, hex, binary or string)")
+		index   = fs.Bool("index", false, "treat arguments as indices and print their keys (requires a reverse map)")
+	)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *file == "" || (fs.NArg() == 0 && *keyFile == "") {
+		fs.Usage()
+		return errUsage
+	}
+	bb, err := readFunction(*file)
+	if err != nil {
+		return err
+	}
+
+	if *index {
+		if !bb.HasReverseMap() {
+			return fmt.Errorf("%s: no reverse map", *file)
+		}
+		for _, arg := range fs.Args() {
+			i, err := strconv.ParseUint(arg, 0, 64)
+			if err != nil {
+				return fmt.Errorf("invalid index %q: %w", arg, err)
+			}
+			key, ok := bb.LookupKey(i)
+			if !ok {
+				return fmt.Errorf("index %d out of range", i)
+			}
+			fmt.Fprintf(stdout, "%d\t%d\n", i, key)
+		}
+		return nil
+	}
+	for _, arg := range fs.Args() {
+		key, err := parseKey(*format, arg)
+		if err != nil {
+			return fmt.Errorf("invalid key %q: %w", arg, err)
+		}
+		fmt.Fprintf(stdout, "%s\t%d\n", arg, bb.Find(key))
+	}
+	if *keyFile != "" {
+		keys, err := readKeyFile(*keyFile, *format)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			fmt.Fprintf(stdout, "%d\t%d\n", key, bb.Find(key))
+		}
+	}
+	return nil
+}
+
+// maxReported is the maximum number of mapping errors reported by verify.
+const maxReported = 10
+
+// verify checks that the keys in a key file map bijectively onto [1, n].
+func verify(args []string, stdout io.Writer) error {
+	fs := newFlagSet("verify", "[flags] -f <file> -keys <file>")
+	var (
+		file    = fs.String("f", "", "serialized BBHash2 file (required)")
+		keyFile = fs.String("keys", "", `key file (required; "-" for stdin)`)
+		format  = fs.String("format", "text", "key format (text, hex, binary or string)")
+	)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *file == "" || *keyFile == "" {
+		fs.Usage()
+		return errUsage
+	}
+	bb, err := readFunction(*file)
+	if err != nil {
+		return err
+	}
+	keys, err := readKeyFile(*keyFile, *format)
+	if err != nil {
+		return err
+	}
+
+	n := uint64(len(keys))
+	owner := make([]uint64, n+1) // owner[i] holds the key mapped to index i
+	mapped := make([]bool, n+1)
+	failures := 0
+	report := func(format string, args ...any) {
+		if failures < maxReported {
+			fmt.Fprintf(stdout, format+"\n", args...)
+		}
+		failures++
+	}
+	for _, key := range keys {
+		switch i := bb.Find(key); {
+		case i == 0 || i > n:
+			report("key %d: index %d out of range [1, %d]", key, i, n)
+		case mapped[i]:
+			report("key %d: index %d already taken by key %d", key, i, owner[i])
+		default:
+			owner[i], mapped[i] = key, true
+		}
+	}
+	if failures > 0 {
+		if failures > maxReported {
+			fmt.Fprintf(stdout, "... and %d more\n", failures-maxReported)
+		}
+		return fmt.Errorf("%s: %d of %d keys are not mapped bijectively onto [1, %d]", *file, failures, n, n)
+	}
+	fmt.Fprintf(stdout, "ok: %d keys map bijectively onto [1, %d]\n", n, n)
+	return nil
+}
+
+// readFunction reads a serialized BBHash2 from path.
+func readFunction(path string) (*bbhash.BBHash2, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	bb := &bbhash.BBHash2{}
+	if err := bb.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return bb, nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/relab/bbhash"
+)
+
+func TestReadKeys(t *testing.T) {
+	binKeys := binary.LittleEndian.AppendUint64(nil, 7)
+	binKeys = binary.LittleEndian.AppendUint64(binKeys, 1<<63)
+
+	tests := []struct {
+		format  string
+		input   string
+		want    []uint64
+		wantErr bool
+	}{
+		{format: "text", input: "1\n 0x10 \n\n# comment\n0b11\n", want: []uint64{1, 16, 3}},
+		{format: "text", input: "1\nx\n", wantErr: true},
+		{format: "text", input: "1\n0x1\n", wantErr: true},
+		{format: "text", input: "# no keys\n", wantErr: true},
+		{format: "hex", input: "ff\n0x10\nDEADBEEF\n", want: []uint64{255, 16, 0xdeadbeef}},
+		{format: "string", input: "a\n\nb\r\n", want: []uint64{hashOf("a"), hashOf(""), hashOf("b")}},
+		{format: "string", input: "a\na\n", wantErr: true},
+		{format: "binary", input: string(binKeys), want: []uint64{7, 1 << 63}},
+		{format: "binary", input: string(binKeys[:12]), wantErr: true},
+		{format: "unknown", input: "1\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got, err := readKeys(strings.NewReader(tt.input), "test", tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("readKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func hashOf(s string) uint64 {
+	return bbhash.FastHashFunc([]byte(s))
+}
+
+func TestBuildQueryVerify(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "keys.txt")
+	var words []string
+	for i := range 1000 {
+		words = append(words, fmt.Sprintf("word-%d", i))
+	}
+	if err := os.WriteFile(keyFile, []byte(strings.Join(words, "\n")), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	fnFile := filepath.Join(dir, "words.bbhash")
+	if err := run([]string{"build", "-keys", keyFile, "-format", "string", "-partitions", "4", "-reverse-map", "-o", fnFile}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := run([]string{"verify", "-f", fnFile, "-keys", keyFile, "-format", "string"}, &out); err != nil {
+		t.Fatalf("verify failed: %v\n%s", err, out.String())
+	}
+	if !strings.HasPrefix(out.String(), "ok: 1000 keys") {
+		t.Errorf("verify output = %q, want prefix %q", out.String(), "ok: 1000 keys")
+	}
+
+	out.Reset()
+	if err := run([]string{"query", "-f", fnFile, "-format", "string", "word-1"}, &out); err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	var key string
+	var index uint64
+	if _, err := fmt.Sscanf(out.String(), "%s\t%d\n", &key, &index); err != nil {
+		t.Fatalf("unexpected query output %q: %v", out.String(), err)
+	}
+	if key != "word-1" || index < 1 || index > 1000 {
+		t.Errorf("query output = %q, want word-1 with index in [1, 1000]", out.String())
+	}
+
+	out.Reset()
+	if err := run([]string{"query", "-f", fnFile, "-index", fmt.Sprint(index)}, &out); err != nil {
+		t.Fatalf("query -index failed: %v", err)
+	}
+	if want := fmt.Sprintf("%d\t%d\n", index, hashOf("word-1")); out.String() != want {
+		t.Errorf("query -index output = %q, want %q", out.String(), want)
+	}
+
+	// A key file with extra keys is not mapped bijectively
+	extraFile := filepath.Join(dir, "extra.txt")
+	extra := append(words, "extra-1", "extra-2")
+	if err := os.WriteFile(extraFile, []byte(strings.Join(extra, "\n")), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := run([]string{"verify", "-f", fnFile, "-keys", extraFile, "-format", "string"}, &out); err == nil {
+		t.Errorf("verify with extra keys should have failed:\n%s", out.String())
+	}
+}
+
+func TestInspectDiff(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "keys.txt")
+	var lines []string
+	for i := range 5000 {
+		lines = append(lines, fmt.Sprint(i*7+1))
+	}
+	if err := os.WriteFile(keyFile, []byte(strings.Join(lines, "\n")), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]string{
+		"default.bbhash":    {"-partitions", "4"},
+		"indexed.bbhash":    {"-partitions", "4", "-reverse-map"},
+		"compressed.bbhash": {"-partitions", "4", "-compress-reverse-map"},
+		"gamma.bbhash":      {"-partitions", "4", "-gamma", "1.5"},
+		"parallel.bbhash":   {"-parallel"},
+	}
+	for name, flags := range files {
+		args := append([]string{"build", "-keys", keyFile, "-o", filepath.Join(dir, name)}, flags...)
+		if err := run(args, &bytes.Buffer{}); err != nil {
+			t.Fatalf("build %s failed: %v", name, err)
+		}
+	}
+
+	// Wrap the default encoding in a text envelope
+	data, err := os.ReadFile(filepath.Join(dir, "default.bbhash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb := &bbhash.BBHash2{}
+	if err := bb.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	text, err := bb.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "text.bbhash"), text, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.SplitN(string(text), ":", 5)
+	fields[3] = "00000000"
+	if err := os.WriteFile(filepath.Join(dir, "corrupt.bbhash"), []byte(strings.Join(fields, ":")), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file       string
+		encoding   string
+		partitions int
+		reverseMap bool
+		envelope   bool
+		wantErr    bool
+	}{
+		{file: "default.bbhash", encoding: "default", partitions: 4},
+		{file: "indexed.bbhash", encoding: "indexed", partitions: 4, reverseMap: true},
+		{file: "compressed.bbhash", encoding: "indexed", partitions: 4, reverseMap: true},
+		{file: "parallel.bbhash", encoding: "default", partitions: 1},
+		{file: "text.bbhash", encoding: "indexed", partitions: 4, envelope: true},
+		{file: "corrupt.bbhash", encoding: "indexed", partitions: 4, envelope: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run("inspect/"+tt.file, func(t *testing.T) {
+			var out bytes.Buffer
+			err := run([]string{"inspect", filepath.Join(dir, tt.file)}, &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("inspect error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var r report
+			if err := json.Unmarshal(out.Bytes(), &r); err != nil {
+				t.Fatalf("invalid JSON output: %v\n%s", err, out.String())
+			}
+			if r.Keys != 5000 || r.Encoding != tt.encoding || len(r.Partitions) != tt.partitions || r.ReverseMap != tt.reverseMap {
+				t.Errorf("inspect = {keys: %d, encoding: %s, partitions: %d, reverse map: %t}, want {5000, %s, %d, %t}",
+					r.Keys, r.Encoding, len(r.Partitions), r.ReverseMap, tt.encoding, tt.partitions, tt.reverseMap)
+			}
+			if (r.Envelope != nil) != tt.envelope || (r.Envelope != nil && r.Envelope.ChecksumValid == tt.wantErr) {
+				t.Errorf("inspect envelope = %+v, want envelope %t with valid checksum %t", r.Envelope, tt.envelope, !tt.wantErr)
+			}
+			s := r.Size
+			if sum := s.Envelope + s.Header + s.Index + s.BitVectors + s.ReverseMap + s.Offsets; sum != s.Total {
+				t.Errorf("size breakdown %+v sums to %d, want %d", s, sum, s.Total)
+			}
+			if r.Compressed && s.ReverseMap >= 8*int(r.Keys) {
+				t.Errorf("compressed reverse map uses %d bytes, want less than %d", s.ReverseMap, 8*r.Keys)
+			}
+		})
+	}
+
+	diffTests := []struct {
+		a, b    string
+		wantErr error
+	}{
+		{a: "default.bbhash", b: "default.bbhash"},
+		{a: "indexed.bbhash", b: "compressed.bbhash", wantErr: errDiffer},
+		{a: "default.bbhash", b: "text.bbhash", wantErr: errDiffer}, // encoding differs
+		{a: "default.bbhash", b: "gamma.bbhash", wantErr: errDiffer},
+		{a: "default.bbhash", b: "parallel.bbhash", wantErr: errDiffer},
+	}
+	for _, tt := range diffTests {
+		t.Run("diff/"+tt.a+"/"+tt.b, func(t *testing.T) {
+			var out bytes.Buffer
+			err := run([]string{"diff", filepath.Join(dir, tt.a), filepath.Join(dir, tt.b)}, &out)
+			if err != tt.wantErr {
+				t.Fatalf("diff error = %v, want %v\n%s", err, tt.wantErr, out.String())
+			}
+			if (out.Len() > 0) != (tt.wantErr != nil) {
+				t.Errorf("diff output = %q", out.String())
+			}
+		})
+	}
+}
+
+func TestValues(t *testing.T) {
+	dir := t.TempDir()
+	keys := make([]uint64, 5000)
+	for i := range keys {
+		keys[i] = uint64(i)*7919 + 1
+	}
+	bb, err := bbhash.New(keys, bbhash.Partitions(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := bb.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fnFile := filepath.Join(dir, "keys.bbhash")
+	if err := os.WriteFile(fnFile, data, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	// each record is a key followed by a 4-byte value; the keys are in reverse order
+	var records []byte
+	for _, key := range slices.Backward(keys) {
+		records = binary.LittleEndian.AppendUint64(records, key)
+		records = binary.LittleEndian.AppendUint32(records, uint32(key))
+	}
+	recordFile := filepath.Join(dir, "records.bin")
+	if err := os.WriteFile(recordFile, records, 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	valueFile := filepath.Join(dir, "values.bin")
+	if err := run([]string{"values", "-f", fnFile, "-records", recordFile, "-width", "4", "-tmp", dir, "-o", valueFile}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("values failed: %v", err)
+	}
+	values, err := os.ReadFile(valueFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 4*len(keys) {
+		t.Fatalf("len(values) = %d, want %d", len(values), 4*len(keys))
+	}
+	for _, key := range keys {
+		index := bb.Find(key)
+		if got := binary.LittleEndian.Uint32(values[(index-1)*4:]); got != uint32(key) {
+			t.Errorf("value at index %d = %d, want %d", index, got, uint32(key))
+		}
+	}
+
+	// A failed run leaves neither a partial output nor temporary files behind,
+	// and does not replace an existing output.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newFile := filepath.Join(dir, "new.bin")
+	for _, output := range []string{valueFile, newFile} {
+		if err := run([]string{"values", "-f", fnFile, "-records", recordFile, "-width", "5", "-o", output}, &bytes.Buffer{}); err == nil {
+			t.Error("values succeeded with the wrong width")
+		}
+	}
+	if got, err := os.ReadFile(valueFile); err != nil || !bytes.Equal(got, values) {
+		t.Errorf("failed run changed the existing output (%v)", err)
+	}
+	if after, err := os.ReadDir(dir); err != nil || len(after) != len(entries) {
+		t.Errorf("failed runs left %d new files in the output directory (%v)", len(after)-len(entries), err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/relab/bbhash/valuefile"
+)
+
+// values reads (key, value) records and writes their values in index order.
+func values(args []string, _ io.Writer) error {
+	fs := newFlagSet("values", "[flags] -f <file> -records <file> -width <n> -o <file>")
+	var (
+		file    = fs.String("f", "", "serialized BBHash2 file (required)")
+		records = fs.String("records", "", `record file of little-endian uint64 keys, each followed by a value of -width bytes (required; "-" for stdin)`)
+		width   = fs.Int("width", 0, "value width in bytes (required)")
+		output  = fs.String("o", "", `output file (required; "-" for stdout)`)
+		memory  = fs.Int("mem", 256, "memory budget for the values of a bucket in MiB")
+		tempDir = fs.String("tmp", "", "directory of the temporary bucket files (default is the system temporary directory)")
+	)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *file == "" || *records == "" || *width < 1 || *output == "" {
+		fs.Usage()
+		return errUsage
+	}
+	bb, err := readFunction(*file)
+	if err != nil {
+		return err
+	}
+
+	in := os.Stdin
+	if *records != "-" {
+		if in, err = os.Open(*records); err != nil {
+			return err
+		}
+		defer in.Close()
+	}
+	out := os.Stdout
+	if *output != "-" {
+		// Write to a temporary file that replaces the output on success,
+		// so that an error does not leave a partial output behind.
+		if out, err = os.CreateTemp(filepath.Dir(*output), filepath.Base(*output)+".*.tmp"); err != nil {
+			return err
+		}
+		defer func() {
+			out.Close()
+			os.Remove(out.Name())
+		}()
+		if err := out.Chmod(0o644); err != nil {
+			return err
+		}
+	}
+	w := bufio.NewWriter(out)
+	src := valuefile.Records(in, *width)
+	stats, err := valuefile.Write(w, bb, *width, src.All(), valuefile.MemoryBudget(*memory<<20), valuefile.TempDir(*tempDir))
+	if err == nil {
+		err = src.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", *records, err)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if *output != "-" {
+		if err := out.Close(); err != nil {
+			return err
+		}
+		if err := os.Rename(out.Name(), *output); err != nil {
+			return err
+		}
+	}
+	log.Printf("wrote %d values to %s (%d records, %d missing, %d buckets)", bb.Len(), *output, stats.Records, stats.Missing, stats.Buckets)
+	return nil
+}
@@ -0,0 +1,108 @@
+// Command bbhashd serves lookups in serialized BBHash2 functions over HTTP.
+//
+// Usage:
+//
+//	bbhashd [flags] [name=]file ...
+//
+// Each file holds a BBHash2 serialized with MarshalBinary or MarshalIndexed,
+// and is served under the given name, or the file's base name without its
+// extension. See package bbhashhttp for the endpoints.
+//
+// The functions are reloaded from their files on SIGHUP, and whenever a file
+// changes if -watch is non-zero. A function whose file cannot be decoded keeps
+// its previous version, so files should be replaced atomically by renaming.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/relab/bbhash/bbhashhttp"
+)
+
+func main() {
+	var (
+		addr  = flag.String("addr", "localhost:8080", "address to listen on")
+		watch = flag.Duration("watch", 2*time.Second, "interval between checks for changed files (0 disables)")
+	)
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: bbhashd [flags] [name=]file ...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	log.SetFlags(log.LstdFlags)
+	log.SetPrefix("bbhashd: ")
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	h := bbhashhttp.NewHandler()
+	for _, arg := range flag.Args() {
+		name, path := parseArg(arg)
+		if err := h.LoadFile(name, path); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("loaded %q from %s", name, path)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *watch > 0 {
+		go h.Watch(ctx, *watch)
+	}
+	go reloadOnHangup(ctx, h)
+
+	srv := &http.Server{Addr: *addr, Handler: h}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Print(err)
+		}
+	}()
+	log.Printf("serving %s on %s", strings.Join(h.Names(), ", "), *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+// parseArg splits an argument of the form [name=]file into a name and a path.
+// Without a name, the file's base name without its extension is used.
+func parseArg(arg string) (name, path string) {
+	if name, path, ok := strings.Cut(arg, "="); ok {
+		return name, path
+	}
+	base := filepath.Base(arg)
+	return strings.TrimSuffix(base, filepath.Ext(base)), arg
+}
+
+// reloadOnHangup reloads the functions whenever the process receives SIGHUP.
+func reloadOnHangup(ctx context.Context, h *bbhashhttp.Handler) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := h.Reload(); err != nil {
+				log.Print(err)
+			} else {
+				log.Print("reloaded all functions")
+			}
+		}
+	}
+}
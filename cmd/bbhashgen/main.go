@@ -0,0 +1,134 @@
+// Command bbhashgen generates a standalone Go or C lookup function for a set of keys.
+//
+// The key file holds one unsigned integer key per line, in decimal or with a
+// 0x, 0o or 0b prefix. Empty lines and lines starting with # are ignored.
+// The generated file has no dependency on the bbhash module.
+//
+// The command is intended to be used with go generate:
+//
+//	//go:generate go run github.com/relab/bbhash/cmd/bbhashgen -keys colors.txt -name colors
+//
+// This generates colors_bbhash.go in the current package, declaring:
+//
+//	func colorsFind(key uint64) uint64
+//	func colorsLookup(key uint64) (uint64, bool)
+//
+// With -lang c, the command instead writes <name>.h and <name>.c to the
+// directory given by -o (default: the current directory), declaring:
+//
+//	uint64_t colors_find(uint64_t key);
+//	bool colors_lookup(uint64_t key, uint64_t *index);
+//
+// The generated functions return the same results as Find and Lookup for every
+// key, including false positives for keys that are not in the original key set.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/relab/bbhash"
+	"github.com/relab/bbhash/keysource"
+)
+
+func main() {
+	var (
+		keyFile    = flag.String("keys", "", "file with one key per line (required)")
+		pkg        = flag.String("pkg", os.Getenv("GOPACKAGE"), "package name of the generated file (default $GOPACKAGE or main)")
+		lang       = flag.String("lang", "go", "language of the generated code (go or c)")
+		name       = flag.String("name", "mphf", "name of the lookup function, without the Find suffix")
+		output     = flag.String("o", "", `output file (default "<name>_bbhash.go"; use "-" for stdout); output directory for -lang c`)
+		gamma      = flag.Float64("gamma", 2.0, "gamma parameter")
+		partitions = flag.Int("partitions", 1, "number of partitions")
+	)
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("bbhashgen: ")
+
+	if *keyFile == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *pkg == "" {
+		*pkg = "main"
+	}
+	if *lang != "go" && *lang != "c" {
+		log.Fatalf("unknown language %q", *lang)
+	}
+
+	keys, err := readKeys(*keyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	bb, err := bbhash.New(keys, bbhash.Gamma(*gamma), bbhash.Partitions(*partitions))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *lang == "c" {
+		if err := writeC(bb, *output, *name); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := bb.WriteGo(&buf, *pkg, *name); err != nil {
+		log.Fatal(err)
+	}
+	if *output == "" {
+		*output = strings.ToLower(*name) + "_bbhash.go"
+	}
+	if *output == "-" {
+		_, err = os.Stdout.Write(buf.Bytes())
+	} else {
+		err = os.WriteFile(*output, buf.Bytes(), 0o666)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeC writes the C header and source files for bb to dir.
+func writeC(bb *bbhash.BBHash2, dir, name string) error {
+	var h, c bytes.Buffer
+	if err := bb.WriteC(&h, &c, name); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".h"), h.Bytes(), 0o666); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name+".c"), c.Bytes(), 0o666)
+}
+
+// readKeys reads unique keys from the given file, one per line.
+func readKeys(path string) ([]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	src := keysource.Parse(f, func(s string) (uint64, error) { return strconv.ParseUint(s, 0, 64) })
+	var keys []uint64
+	seen := make(map[uint64]int)
+	for key := range src.All() {
+		if prev, ok := seen[key]; ok {
+			return nil, fmt.Errorf("%s: duplicate key %d (keys %d and %d)", path, key, prev+1, len(keys)+1)
+		}
+		seen[key] = len(keys)
+		keys = append(keys, key)
+	}
+	if err := src.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no keys", path)
+	}
+	return keys, nil
+}
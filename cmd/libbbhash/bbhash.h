@@ -0,0 +1,78 @@
+/*
+ * C API for querying BBHash2 minimal perfect hash functions built in Go.
+ *
+ * Build the shared library with:
+ *
+ *   go build -buildmode=c-shared -o libbbhash.so ./cmd/libbbhash
+ *
+ * Functions are referred to by handles returned by bbhash_load. A handle
+ * remains valid until it is passed to bbhash_free. All functions are safe
+ * to call concurrently from multiple threads.
+ */
+#ifndef BBHASH_H
+#define BBHASH_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+/* bbhash_handle refers to a loaded function; 0 is never a valid handle. */
+typedef uint64_t bbhash_handle;
+
+/*
+ * bbhash_load loads a function serialized with BBHash2.MarshalBinary or
+ * BBHash2.MarshalIndexed from the file at path. It returns 0 on failure;
+ * see bbhash_last_error.
+ */
+bbhash_handle bbhash_load(const char *path);
+
+/*
+ * bbhash_find returns the index in [1, n] of the given key, where n is the
+ * number of keys in the function. It returns 0 if the key is not found or
+ * the handle is invalid. Like BBHash2.Find, keys that were not in the
+ * original key set may be reported with a false positive index.
+ */
+uint64_t bbhash_find(bbhash_handle h, uint64_t key);
+
+/*
+ * bbhash_find_batch stores the index of keys[i] in out[i] for i in [0, n).
+ * It returns 0 on success and -1 if the handle is invalid.
+ */
+int bbhash_find_batch(bbhash_handle h, const uint64_t *keys, size_t n, uint64_t *out);
+
+/*
+ * bbhash_key returns the key for the given index. It returns 0 if the index
+ * is out of range, the handle is invalid, or the function was serialized
+ * without a reverse map. Since 0 is also a valid key, use bbhash_lookup_key
+ * to distinguish these cases.
+ */
+uint64_t bbhash_key(bbhash_handle h, uint64_t index);
+
+/*
+ * bbhash_lookup_key stores the key for the given index in *key. It returns 0
+ * on success and -1 if the handle is invalid, the index is out of range, or
+ * the function was serialized without a reverse map; *key is then unchanged.
+ */
+int bbhash_lookup_key(bbhash_handle h, uint64_t index, uint64_t *key);
+
+/*
+ * bbhash_free releases the function referred to by h.
+ * It returns 0 on success and -1 if the handle is invalid.
+ */
+int bbhash_free(bbhash_handle h);
+
+/*
+ * bbhash_last_error copies the message of the most recent error in any
+ * thread, truncated and NUL-terminated, into buf of size len. It returns the
+ * length of the full message, or 0 if no error has occurred.
+ */
+size_t bbhash_last_error(char *buf, size_t len);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif /* BBHASH_H */
@@ -0,0 +1,151 @@
+// Command libbbhash is a C shared library for querying BBHash2 functions
+// from C, C++, Python and other languages with a C foreign function interface.
+//
+// Build the library with:
+//
+//	go build -buildmode=c-shared -o libbbhash.so ./cmd/libbbhash
+//
+// The C API is declared in bbhash.h in this directory; use it instead of the
+// header generated by the go command. Functions are referred to by handles
+// returned by bbhash_load; a handle remains valid until passed to bbhash_free.
+// The test harness in testdata/harness.c shows how to use the API.
+package main
+
+/*
+#include <stddef.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"unsafe"
+
+	"github.com/relab/bbhash"
+)
+
+// handles maps handles to loaded functions.
+var handles = struct {
+	sync.RWMutex
+	m    map[uint64]*bbhash.BBHash2
+	next uint64
+}{m: make(map[uint64]*bbhash.BBHash2)}
+
+// lastErr holds the most recent error message.
+var lastErr struct {
+	sync.Mutex
+	msg string
+}
+
+func setError(err error) {
+	lastErr.Lock()
+	lastErr.msg = err.Error()
+	lastErr.Unlock()
+}
+
+// lookup returns the function for the given handle, or nil if the handle is invalid.
+func lookup(h C.uint64_t) *bbhash.BBHash2 {
+	handles.RLock()
+	defer handles.RUnlock()
+	return handles.m[uint64(h)]
+}
+
+//export bbhash_load
+func bbhash_load(path *C.char) C.uint64_t {
+	data, err := os.ReadFile(C.GoString(path))
+	if err != nil {
+		setError(err)
+		return 0
+	}
+	bb := &bbhash.BBHash2{}
+	if err := bb.UnmarshalBinary(data); err != nil {
+		setError(fmt.Errorf("%s: %w", C.GoString(path), err))
+		return 0
+	}
+	handles.Lock()
+	defer handles.Unlock()
+	handles.next++
+	handles.m[handles.next] = bb
+	return C.uint64_t(handles.next)
+}
+
+//export bbhash_find
+func bbhash_find(h C.uint64_t, key C.uint64_t) C.uint64_t {
+	bb := lookup(h)
+	if bb == nil {
+		return 0
+	}
+	return C.uint64_t(bb.Find(uint64(key)))
+}
+
+//export bbhash_find_batch
+func bbhash_find_batch(h C.uint64_t, keys *C.uint64_t, n C.size_t, out *C.uint64_t) C.int {
+	bb := lookup(h)
+	if bb == nil {
+		setError(fmt.Errorf("bbhash_find_batch: invalid handle %d", h))
+		return -1
+	}
+	if n == 0 {
+		return 0
+	}
+	in := unsafe.Slice((*uint64)(unsafe.Pointer(keys)), n)
+	res := unsafe.Slice((*uint64)(unsafe.Pointer(out)), n)
+	for i, key := range in {
+		res[i] = bb.Find(key)
+	}
+	return 0
+}
+
+//export bbhash_key
+func bbhash_key(h C.uint64_t, index C.uint64_t) C.uint64_t {
+	bb := lookup(h)
+	if bb == nil {
+		return 0
+	}
+	return C.uint64_t(bb.Key(uint64(index)))
+}
+
+//export bbhash_lookup_key
+func bbhash_lookup_key(h C.uint64_t, index C.uint64_t, key *C.uint64_t) C.int {
+	bb := lookup(h)
+	if bb == nil {
+		setError(fmt.Errorf("bbhash_lookup_key: invalid handle %d", h))
+		return -1
+	}
+	k, ok := bb.LookupKey(uint64(index))
+	if !ok {
+		setError(fmt.Errorf("bbhash_lookup_key: no key for index %d", index))
+		return -1
+	}
+	*key = C.uint64_t(k)
+	return 0
+}
+
+//export bbhash_free
+func bbhash_free(h C.uint64_t) C.int {
+	handles.Lock()
+	defer handles.Unlock()
+	if _, ok := handles.m[uint64(h)]; !ok {
+		setError(fmt.Errorf("bbhash_free: invalid handle %d", h))
+		return -1
+	}
+	delete(handles.m, uint64(h))
+	return 0
+}
+
+//export bbhash_last_error
+func bbhash_last_error(buf *C.char, n C.size_t) C.size_t {
+	lastErr.Lock()
+	msg := lastErr.msg
+	lastErr.Unlock()
+	if n > 0 {
+		dst := unsafe.Slice((*byte)(unsafe.Pointer(buf)), n)
+		k := copy(dst[:n-1], msg)
+		dst[k] = 0
+	}
+	return C.size_t(len(msg))
+}
+
+func main() {}
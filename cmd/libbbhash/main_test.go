@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/relab/bbhash"
+)
+
+// TestHarness builds the shared library and runs the C test harness against it.
+func TestHarness(t *testing.T) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("C compiler not found")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "libbbhash.so")
+	build := exec.Command(goTool, "build", "-buildmode=c-shared", "-o", lib, ".")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+	harness := filepath.Join(dir, "harness")
+	compile := exec.Command(cc, "-std=c99", "-Wall", "-Werror", "-I.", "-o", harness,
+		filepath.Join("testdata", "harness.c"), "-L"+dir, "-lbbhash", "-Wl,-rpath,"+dir)
+	if out, err := compile.CombinedOutput(); err != nil {
+		t.Fatalf("%s failed: %v\n%s", cc, err, out)
+	}
+
+	for _, partitions := range []int{1, 8} {
+		t.Run(fmt.Sprintf("partitions=%d", partitions), func(t *testing.T) {
+			keys := generateKeys(10000, 99)
+			bb, err := bbhash.New(keys, bbhash.Partitions(partitions), bbhash.WithReverseMap())
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := bb.MarshalIndexed()
+			if err != nil {
+				t.Fatal(err)
+			}
+			funcFile := filepath.Join(t.TempDir(), "func.bbhash")
+			if err := os.WriteFile(funcFile, data, 0o666); err != nil {
+				t.Fatal(err)
+			}
+			var keyLines strings.Builder
+			for _, k := range keys {
+				fmt.Fprintln(&keyLines, k)
+			}
+			keyFile := filepath.Join(t.TempDir(), "keys.txt")
+			if err := os.WriteFile(keyFile, []byte(keyLines.String()), 0o666); err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := exec.Command(harness, funcFile, keyFile).Output()
+			if err != nil {
+				if ee, ok := err.(*exec.ExitError); ok {
+					t.Fatalf("harness failed: %v\n%s", err, ee.Stderr)
+				}
+				t.Fatalf("harness failed: %v", err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+			if len(lines) != len(keys) {
+				t.Fatalf("got %d lines of output, want %d", len(lines), len(keys))
+			}
+			for i, line := range lines {
+				var index, key uint64
+				if _, err := fmt.Sscan(line, &index, &key); err != nil {
+					t.Fatalf("line %d: %v", i, err)
+				}
+				if want := bb.Find(keys[i]); index != want {
+					t.Errorf("bbhash_find(%d) = %d, want %d", keys[i], index, want)
+				}
+				if key != keys[i] {
+					t.Errorf("bbhash_key(%d) = %d, want %d", index, key, keys[i])
+				}
+			}
+		})
+	}
+}
+
+func generateKeys(size, seed int) []uint64 {
+	keys := make([]uint64, size)
+	r := rand.New(rand.NewSource(int64(seed)))
+	for i := range keys {
+		keys[i] = r.Uint64()
+	}
+	return keys
+}
@@ -0,0 +1,85 @@
+/*
+ * harness exercises the libbbhash C API.
+ *
+ * Usage: harness <function-file> <key-file>
+ *
+ * The key file holds one decimal key per line. For each key, the harness
+ * prints the index returned by bbhash_find and the key returned by bbhash_key
+ * for that index. It also checks that bbhash_find_batch agrees with
+ * bbhash_find, that bbhash_lookup_key agrees with bbhash_key and rejects
+ * out-of-range indices, and that invalid handles and files are reported as errors.
+ * It exits with a non-zero status if any check fails.
+ */
+#include <inttypes.h>
+#include <stdio.h>
+#include <stdlib.h>
+
+#include "bbhash.h"
+
+static int failures;
+
+static void check(int ok, const char *what)
+{
+	if (!ok) {
+		char msg[256];
+		bbhash_last_error(msg, sizeof(msg));
+		fprintf(stderr, "FAIL: %s (last error: %s)\n", what, msg);
+		failures++;
+	}
+}
+
+int main(int argc, char **argv)
+{
+	if (argc != 3) {
+		fprintf(stderr, "usage: %s <function-file> <key-file>\n", argv[0]);
+		return 2;
+	}
+
+	FILE *f = fopen(argv[2], "r");
+	if (f == NULL) {
+		perror(argv[2]);
+		return 2;
+	}
+	size_t n = 0, cap = 1024;
+	uint64_t *keys = malloc(cap * sizeof(uint64_t));
+	uint64_t key;
+	while (fscanf(f, "%" SCNu64, &key) == 1) {
+		if (n == cap) {
+			cap *= 2;
+			keys = realloc(keys, cap * sizeof(uint64_t));
+		}
+		keys[n++] = key;
+	}
+	fclose(f);
+
+	bbhash_handle h = bbhash_load(argv[1]);
+	check(h != 0, "bbhash_load");
+	if (h == 0) {
+		return 1;
+	}
+
+	uint64_t *batch = malloc(n * sizeof(uint64_t));
+	check(bbhash_find_batch(h, keys, n, batch) == 0, "bbhash_find_batch");
+	for (size_t i = 0; i < n; i++) {
+		uint64_t index = bbhash_find(h, keys[i]);
+		check(batch[i] == index, "bbhash_find_batch agrees with bbhash_find");
+		uint64_t found = 0;
+		check(bbhash_lookup_key(h, index, &found) == 0, "bbhash_lookup_key");
+		check(found == bbhash_key(h, index), "bbhash_lookup_key agrees with bbhash_key");
+		printf("%" PRIu64 " %" PRIu64 "\n", index, bbhash_key(h, index));
+	}
+	check(bbhash_lookup_key(h, 0, &key) == -1, "bbhash_lookup_key of index 0 fails");
+	check(bbhash_lookup_key(h, n + 1, &key) == -1, "bbhash_lookup_key of index n+1 fails");
+
+	check(bbhash_free(h) == 0, "bbhash_free");
+	check(bbhash_free(h) == -1, "bbhash_free of a freed handle fails");
+	check(bbhash_find(h, keys[0]) == 0, "bbhash_find with a freed handle returns 0");
+	check(bbhash_find_batch(h, keys, n, batch) == -1, "bbhash_find_batch with a freed handle fails");
+	check(bbhash_lookup_key(h, 1, &key) == -1, "bbhash_lookup_key with a freed handle fails");
+	check(bbhash_load("/nonexistent/function") == 0, "bbhash_load of a missing file fails");
+	check(bbhash_last_error(NULL, 0) > 0, "bbhash_last_error reports the failed load");
+
+	free(batch);
+	free(keys);
+	return failures == 0 ? 0 : 1;
+}
@@ -0,0 +1,294 @@
+// Package dedup builds chunk deduplication indexes on top of bbhash.
+//
+// A Builder splits a set of files into chunks, hashes each chunk, and keeps the
+// location of the first occurrence of each unique chunk hash. Build creates a
+// BBHash2 over the unique hashes and an Index that maps each of its indices to
+// the location (file, offset, length) of the chunk. The Index can then report
+// which chunks of a new file already exist.
+//
+// Chunk hashes are 64 bits, so with billions of unique chunks, two different
+// chunks may collide and be reported as duplicates. The hash function and
+// chunking parameters are stored in the index, so that queries chunk new files
+// the same way.
+package dedup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+
+	"github.com/relab/bbhash"
+)
+
+// HashFunc identifies the hash function used to hash chunks.
+type HashFunc uint8
+
+const (
+	// SHA256 hashes chunks with bbhash.SHA256HashFunc.
+	SHA256 HashFunc = iota + 1
+	// FastHash hashes chunks with bbhash.FastHashFunc.
+	FastHash
+)
+
+// String returns the name of the hash function.
+func (h HashFunc) String() string {
+	switch h {
+	case SHA256:
+		return "sha256"
+	case FastHash:
+		return "fast"
+	}
+	return fmt.Sprintf("HashFunc(%d)", uint8(h))
+}
+
+// hash returns the hash function identified by h, or nil if it is unknown.
+func (h HashFunc) hash() func([]byte) uint64 {
+	switch h {
+	case SHA256:
+		return bbhash.SHA256HashFunc
+	case FastHash:
+		return bbhash.FastHashFunc
+	}
+	return nil
+}
+
+// Options are options for creating a Builder.
+type Options func(*options)
+
+// options holds the chunking parameters. If fixedSize is non-zero,
+// fixed-size chunking is used; otherwise content-defined chunking is used.
+type options struct {
+	hash                      HashFunc
+	fixedSize                 int
+	minSize, avgSize, maxSize int
+}
+
+func newOptions(opts ...Options) *options {
+	o := &options{
+		hash:    SHA256,
+		minSize: 2048,
+		avgSize: 8192,
+		maxSize: 65536,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// ContentDefined sets the minimum, average and maximum chunk sizes of content-defined
+// chunking; see bbhash.ContentDefinedChunks. This is the default, with sizes 2 KiB,
+// 8 KiB and 64 KiB.
+func ContentDefined(minSize, avgSize, maxSize int) Options {
+	return func(o *options) {
+		o.fixedSize = 0
+		o.minSize, o.avgSize, o.maxSize = minSize, avgSize, maxSize
+	}
+}
+
+// FixedSize sets fixed-size chunking with the given chunk size; see bbhash.FixedChunks.
+func FixedSize(size int) Options {
+	return func(o *options) {
+		o.fixedSize = size
+	}
+}
+
+// Hash sets the hash function used to hash chunks. The default is SHA256.
+func Hash(h HashFunc) Options {
+	return func(o *options) {
+		o.hash = h
+	}
+}
+
+// validate checks the chunking parameters.
+func (o *options) validate() error {
+	if o.hash.hash() == nil {
+		return fmt.Errorf("unknown hash function %v", o.hash)
+	}
+	if o.fixedSize != 0 {
+		if o.fixedSize < 0 || o.fixedSize > maxChunkSize {
+			return fmt.Errorf("invalid chunk size %d", o.fixedSize)
+		}
+		return nil
+	}
+	if o.minSize <= 0 || o.minSize > o.avgSize || o.avgSize > o.maxSize || o.avgSize < 2 || o.maxSize > maxChunkSize {
+		return fmt.Errorf("invalid chunk sizes min=%d, avg=%d, max=%d", o.minSize, o.avgSize, o.maxSize)
+	}
+	return nil
+}
+
+// maxChunkSize is the maximum chunk size, since chunk lengths are stored as uint32.
+const maxChunkSize = 1 << 30
+
+// chunks returns the chunks of r according to the chunking parameters.
+func (o *options) chunks(r io.Reader) iter.Seq2[bbhash.Chunk, error] {
+	if o.fixedSize != 0 {
+		return bbhash.FixedChunks(r, o.fixedSize)
+	}
+	return bbhash.ContentDefinedChunks(r, o.minSize, o.avgSize, o.maxSize)
+}
+
+// Location is the location of a chunk in one of the indexed files.
+type Location struct {
+	File   uint32 // index of the file in Index.Files
+	Offset int64
+	Length uint32
+}
+
+// Stats holds statistics of the chunks added to a Builder.
+type Stats struct {
+	Files        int
+	Chunks       uint64 // number of chunks
+	UniqueChunks uint64 // number of chunks with distinct hashes
+	Bytes        uint64 // total size of the chunks
+	UniqueBytes  uint64 // total size of the unique chunks
+}
+
+// Builder collects the unique chunks of a set of files.
+type Builder struct {
+	opts      *options
+	files     []string
+	hashes    []uint64 // unique chunk hashes, in the order they were first seen
+	locations []Location
+	seen      map[uint64]struct{}
+	stats     Stats
+}
+
+// NewBuilder returns a Builder with the given chunking options.
+func NewBuilder(opts ...Options) (*Builder, error) {
+	o := newOptions(opts...)
+	if err := o.validate(); err != nil {
+		return nil, fmt.Errorf("dedup.NewBuilder: %w", err)
+	}
+	return &Builder{opts: o, seen: make(map[uint64]struct{})}, nil
+}
+
+// AddFile chunks the file at path and adds its unique chunks.
+func (b *Builder) AddFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return b.Add(path, f)
+}
+
+// Add chunks the data read from r and adds its unique chunks under the given file name.
+// If reading fails, the chunks read before the error have been added.
+func (b *Builder) Add(name string, r io.Reader) error {
+	file := uint32(len(b.files))
+	b.files = append(b.files, name)
+	b.stats.Files++
+	hash := b.opts.hash.hash()
+	for c, err := range b.opts.chunks(r) {
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		h := hash(c.Data)
+		b.stats.Chunks++
+		b.stats.Bytes += uint64(len(c.Data))
+		if _, ok := b.seen[h]; ok {
+			continue
+		}
+		b.seen[h] = struct{}{}
+		b.hashes = append(b.hashes, h)
+		b.locations = append(b.locations, Location{File: file, Offset: c.Offset, Length: uint32(len(c.Data))})
+		b.stats.UniqueChunks++
+		b.stats.UniqueBytes += uint64(len(c.Data))
+	}
+	return nil
+}
+
+// Stats returns statistics of the chunks added so far.
+func (b *Builder) Stats() Stats {
+	return b.stats
+}
+
+// Build returns an Index of the unique chunks added so far.
+// The given bbhash options are passed to bbhash.New; WithReverseMap
+// is always added, since queries use it to confirm chunk hashes.
+// Hence, the Parallel option cannot be used.
+func (b *Builder) Build(opts ...bbhash.Options) (*Index, error) {
+	if len(b.hashes) == 0 {
+		return nil, errors.New("dedup.Builder.Build: no chunks")
+	}
+	bb, err := bbhash.New(b.hashes, append(opts[:len(opts):len(opts)], bbhash.WithReverseMap())...)
+	if err != nil {
+		return nil, fmt.Errorf("dedup.Builder.Build: %w", err)
+	}
+	// Order the locations by the index of their chunk hash.
+	locations := make([]Location, len(b.locations))
+	for i, h := range b.hashes {
+		locations[bb.Find(h)-1] = b.locations[i]
+	}
+	return &Index{
+		Files:     append([]string(nil), b.files...),
+		opts:      *b.opts,
+		bb:        bb,
+		locations: locations,
+	}, nil
+}
+
+// Index maps the hashes of unique chunks to their locations.
+type Index struct {
+	// Files holds the names of the indexed files.
+	Files []string
+
+	opts      options
+	bb        *bbhash.BBHash2 // over the unique chunk hashes, with a reverse map
+	locations []Location      // locations[i-1] is the location of the chunk with index i
+}
+
+// Len returns the number of unique chunks in the index.
+func (ix *Index) Len() int {
+	return len(ix.locations)
+}
+
+// Lookup returns the location of the chunk with the given hash,
+// or false if the index has no such chunk.
+func (ix *Index) Lookup(hash uint64) (Location, bool) {
+	i, ok := ix.bb.FindExact(hash)
+	if !ok || i > uint64(len(ix.locations)) {
+		return Location{}, false
+	}
+	return ix.locations[i-1], true
+}
+
+// Match describes a chunk of a queried file.
+type Match struct {
+	Offset   int64 // offset of the chunk in the queried file
+	Length   int
+	Hash     uint64
+	Found    bool     // true if the chunk exists in the index
+	Location Location // location of the existing chunk, if found
+}
+
+// Query chunks the data read from r the same way as the indexed files,
+// and reports for each chunk whether it exists in the index.
+// If reading fails, the error is yielded and the iteration stops.
+func (ix *Index) Query(r io.Reader) iter.Seq2[Match, error] {
+	return func(yield func(Match, error) bool) {
+		hash := ix.opts.hash.hash()
+		for c, err := range ix.opts.chunks(r) {
+			if err != nil {
+				yield(Match{}, err)
+				return
+			}
+			m := Match{Offset: c.Offset, Length: len(c.Data), Hash: hash(c.Data)}
+			m.Location, m.Found = ix.Lookup(m.Hash)
+			if !yield(m, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Chunking returns a description of the index's chunking parameters.
+func (ix *Index) Chunking() string {
+	if ix.opts.fixedSize != 0 {
+		return fmt.Sprintf("fixed(size=%d, hash=%v)", ix.opts.fixedSize, ix.opts.hash)
+	}
+	return fmt.Sprintf("content-defined(min=%d, avg=%d, max=%d, hash=%v)", ix.opts.minSize, ix.opts.avgSize, ix.opts.maxSize, ix.opts.hash)
+}
@@ -0,0 +1,155 @@
+package dedup_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/relab/bbhash"
+	"github.com/relab/bbhash/dedup"
+)
+
+func randomData(size, seed int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(seed))).Read(data)
+	return data
+}
+
+func TestIndex(t *testing.T) {
+	a := randomData(1<<20, 1)
+	b := slices.Concat(a[:1<<19], randomData(1<<19, 2)) // first half shared with a
+	c := slices.Concat(randomData(1<<18, 3), a[1<<18:]) // all but the first quarter shared with a
+
+	tests := []struct {
+		name string
+		opts []dedup.Options
+	}{
+		{name: "ContentDefined"},
+		{name: "ContentDefined/FastHash", opts: []dedup.Options{dedup.ContentDefined(1024, 4096, 16384), dedup.Hash(dedup.FastHash)}},
+		{name: "FixedSize", opts: []dedup.Options{dedup.FixedSize(4096)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := dedup.NewBuilder(tt.opts...)
+			if err != nil {
+				t.Fatalf("NewBuilder() failed: %v", err)
+			}
+			if err := builder.Add("a", bytes.NewReader(a)); err != nil {
+				t.Fatalf("Add(a) failed: %v", err)
+			}
+			if err := builder.Add("b", bytes.NewReader(b)); err != nil {
+				t.Fatalf("Add(b) failed: %v", err)
+			}
+			stats := builder.Stats()
+			if stats.Files != 2 || stats.Bytes != uint64(len(a)+len(b)) || stats.UniqueChunks >= stats.Chunks {
+				t.Errorf("Stats() = %+v, want 2 files, %d bytes and duplicate chunks", stats, len(a)+len(b))
+			}
+			ix, err := builder.Build(bbhash.Partitions(2))
+			if err != nil {
+				t.Fatalf("Build() failed: %v", err)
+			}
+			if ix.Len() != int(stats.UniqueChunks) {
+				t.Errorf("Len() = %d, want %d", ix.Len(), stats.UniqueChunks)
+			}
+
+			// The index survives a round trip through its encoding
+			var buf bytes.Buffer
+			if _, err := ix.WriteTo(&buf); err != nil {
+				t.Fatalf("WriteTo() failed: %v", err)
+			}
+			ix, err = dedup.ReadIndex(&buf)
+			if err != nil {
+				t.Fatalf("ReadIndex() failed: %v", err)
+			}
+			if !slices.Equal(ix.Files, []string{"a", "b"}) {
+				t.Errorf("Files = %v, want [a b]", ix.Files)
+			}
+
+			// Found chunks point at identical data; c shares most of its data with a
+			files := [][]byte{a, b}
+			var found, foundBytes, total int
+			for m, err := range ix.Query(bytes.NewReader(c)) {
+				if err != nil {
+					t.Fatalf("Query() failed: %v", err)
+				}
+				total += m.Length
+				if !m.Found {
+					continue
+				}
+				found++
+				foundBytes += m.Length
+				loc := m.Location
+				got := files[loc.File][loc.Offset : loc.Offset+int64(loc.Length)]
+				if !bytes.Equal(got, c[m.Offset:m.Offset+int64(m.Length)]) {
+					t.Fatalf("chunk at %d found at %+v with different data", m.Offset, loc)
+				}
+			}
+			if total != len(c) {
+				t.Errorf("Query() covered %d bytes, want %d", total, len(c))
+			}
+			// With fixed-size chunks, the shifted data in c is only found where
+			// the shift is a multiple of the chunk size, which it is here.
+			if foundBytes < len(c)/2 {
+				t.Errorf("Query() found %d of %d bytes, want at least half", foundBytes, len(c))
+			}
+
+			// Data not in the index is not found
+			for m, err := range ix.Query(bytes.NewReader(randomData(1<<16, 4))) {
+				if err != nil {
+					t.Fatalf("Query() failed: %v", err)
+				}
+				if m.Found {
+					t.Errorf("chunk at %d of new data reported as found at %+v", m.Offset, m.Location)
+				}
+			}
+		})
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	invalid := [][]dedup.Options{
+		{dedup.ContentDefined(0, 8, 16)},
+		{dedup.ContentDefined(64, 32, 128)},
+		{dedup.FixedSize(-1)},
+		{dedup.Hash(0)},
+	}
+	for _, opts := range invalid {
+		if _, err := dedup.NewBuilder(opts...); err == nil {
+			t.Errorf("NewBuilder() with invalid options should have failed")
+		}
+	}
+	builder, err := dedup.NewBuilder()
+	if err != nil {
+		t.Fatalf("NewBuilder() failed: %v", err)
+	}
+	if _, err := builder.Build(); err == nil {
+		t.Error("Build() without chunks should have failed")
+	}
+	if _, err := dedup.ReadIndex(bytes.NewReader([]byte("BBDX"))); err == nil {
+		t.Error("ReadIndex() of truncated data should have failed")
+	}
+
+	// An index whose location table does not match the BBHash2 is rejected
+	if err := builder.Add("a", bytes.NewReader(randomData(1<<16, 1))); err != nil {
+		t.Fatalf("Add(a) failed: %v", err)
+	}
+	ix, err := builder.Build()
+	if err != nil {
+		t.Fatalf("Build() failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := ix.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() failed: %v", err)
+	}
+	data := buf.Bytes()
+	const countStart = 4 + 2 + 5*4 + 2 + len("a") // header and file table
+	const locationLength = 4 + 8 + 4
+	count := binary.LittleEndian.Uint64(data[countStart:])
+	binary.LittleEndian.PutUint64(data[countStart:], count-1)
+	data = slices.Delete(data, countStart+8, countStart+8+locationLength)
+	if _, err := dedup.ReadIndex(bytes.NewReader(data)); err == nil {
+		t.Error("ReadIndex() with a missing location should have failed")
+	}
+}
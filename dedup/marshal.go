@@ -0,0 +1,196 @@
+package dedup
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/relab/bbhash"
+)
+
+const (
+	// indexMagic identifies a dedup index file.
+	indexMagic = "BBDX"
+
+	// indexVersion is the version of the index file format.
+	indexVersion = 1
+
+	// locationLength is the length of an encoded location: file, offset and length.
+	locationLength = 4 + 8 + 4
+)
+
+// The index file format is (all integers are little-endian):
+//
+//	magic "BBDX", version u8
+//	hash u8, fixed size u32, min size u32, avg size u32, max size u32
+//	number of files u32, then for each file: name length u16, name
+//	number of locations u64, then for each location in index order: file u32, offset u64, length u32
+//	length of the BBHash2 encoding u64, then the BBHash2 in the indexed encoding
+
+// WriteTo implements the [io.WriterTo] interface.
+func (ix *Index) WriteTo(w io.Writer) (int64, error) {
+	bbData, err := ix.bb.MarshalIndexed()
+	if err != nil {
+		return 0, fmt.Errorf("Index.WriteTo: %w", err)
+	}
+	bw := bufio.NewWriter(w)
+	cw := &countWriter{w: bw}
+
+	buf := make([]byte, 0, 64)
+	buf = append(buf, indexMagic...)
+	buf = append(buf, indexVersion, uint8(ix.opts.hash))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(ix.opts.fixedSize))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(ix.opts.minSize))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(ix.opts.avgSize))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(ix.opts.maxSize))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(ix.Files)))
+	cw.Write(buf)
+	for _, name := range ix.Files {
+		if len(name) > math.MaxUint16 {
+			return cw.n, fmt.Errorf("Index.WriteTo: file name too long: %.64s...", name)
+		}
+		buf = binary.LittleEndian.AppendUint16(buf[:0], uint16(len(name)))
+		buf = append(buf, name...)
+		cw.Write(buf)
+	}
+
+	buf = binary.LittleEndian.AppendUint64(buf[:0], uint64(len(ix.locations)))
+	cw.Write(buf)
+	for _, loc := range ix.locations {
+		buf = binary.LittleEndian.AppendUint32(buf[:0], loc.File)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(loc.Offset))
+		buf = binary.LittleEndian.AppendUint32(buf, loc.Length)
+		cw.Write(buf)
+	}
+
+	buf = binary.LittleEndian.AppendUint64(buf[:0], uint64(len(bbData)))
+	cw.Write(buf)
+	cw.Write(bbData)
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, bw.Flush()
+}
+
+// countWriter counts the bytes written and remembers the first error.
+type countWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countWriter) Write(p []byte) {
+	if cw.err != nil {
+		return
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+// WriteFile writes the index to the file at path.
+func (ix *Index) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := ix.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadFile reads an index from the file at path.
+func ReadFile(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ix, err := ReadIndex(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ix, nil
+}
+
+// ReadIndex reads an index written by Index.WriteTo from r.
+func ReadIndex(r io.Reader) (*Index, error) {
+	header := make([]byte, len(indexMagic)+2+5*4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("dedup.ReadIndex: reading header: %w", err)
+	}
+	if string(header[:len(indexMagic)]) != indexMagic {
+		return nil, errors.New("dedup.ReadIndex: not a dedup index")
+	}
+	header = header[len(indexMagic):] // move past magic
+	if version := header[0]; version != indexVersion {
+		return nil, fmt.Errorf("dedup.ReadIndex: unsupported version %d (want %d)", version, indexVersion)
+	}
+	ix := &Index{}
+	ix.opts.hash = HashFunc(header[1])
+	ix.opts.fixedSize = int(binary.LittleEndian.Uint32(header[2:]))
+	ix.opts.minSize = int(binary.LittleEndian.Uint32(header[6:]))
+	ix.opts.avgSize = int(binary.LittleEndian.Uint32(header[10:]))
+	ix.opts.maxSize = int(binary.LittleEndian.Uint32(header[14:]))
+	if err := ix.opts.validate(); err != nil {
+		return nil, fmt.Errorf("dedup.ReadIndex: %w", err)
+	}
+	numFiles := binary.LittleEndian.Uint32(header[18:])
+
+	buf := make([]byte, 8)
+	for range numFiles {
+		if _, err := io.ReadFull(r, buf[:2]); err != nil {
+			return nil, fmt.Errorf("dedup.ReadIndex: reading files: %w", err)
+		}
+		name := make([]byte, binary.LittleEndian.Uint16(buf))
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, fmt.Errorf("dedup.ReadIndex: reading files: %w", err)
+		}
+		ix.Files = append(ix.Files, string(name))
+	}
+
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("dedup.ReadIndex: reading locations: %w", err)
+	}
+	numLocations := binary.LittleEndian.Uint64(buf)
+	locBuf := make([]byte, locationLength)
+	for range numLocations {
+		if _, err := io.ReadFull(r, locBuf); err != nil {
+			return nil, fmt.Errorf("dedup.ReadIndex: reading locations: %w", err)
+		}
+		loc := Location{
+			File:   binary.LittleEndian.Uint32(locBuf),
+			Offset: int64(binary.LittleEndian.Uint64(locBuf[4:])),
+			Length: binary.LittleEndian.Uint32(locBuf[12:]),
+		}
+		if loc.File >= numFiles {
+			return nil, fmt.Errorf("dedup.ReadIndex: invalid file %d in location", loc.File)
+		}
+		ix.locations = append(ix.locations, loc)
+	}
+
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("dedup.ReadIndex: reading BBHash2: %w", err)
+	}
+	bbData, err := io.ReadAll(io.LimitReader(r, int64(binary.LittleEndian.Uint64(buf)&math.MaxInt64)))
+	if err != nil {
+		return nil, fmt.Errorf("dedup.ReadIndex: reading BBHash2: %w", err)
+	}
+	ix.bb = &bbhash.BBHash2{}
+	if err := ix.bb.UnmarshalBinary(bbData); err != nil {
+		return nil, fmt.Errorf("dedup.ReadIndex: %w", err)
+	}
+	if !ix.bb.HasReverseMap() {
+		return nil, errors.New("dedup.ReadIndex: BBHash2 has no reverse map")
+	}
+	if n := uint64(ix.bb.Len()); n != numLocations {
+		return nil, fmt.Errorf("dedup.ReadIndex: %d locations do not match %d chunks", numLocations, n)
+	}
+	return ix, nil
+}
@@ -0,0 +1,204 @@
+package bbhash
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// packedInts is an array of unsigned integers of a fixed bit width, packed into words.
+type packedInts struct {
+	width uint // number of bits per integer, at most 64
+	data  []uint64
+}
+
+// newPackedInts returns a zeroed array of n integers of the given bit width.
+func newPackedInts(n uint64, width uint) packedInts {
+	return packedInts{width: width, data: make([]uint64, packedWords(n, width))}
+}
+
+// packedWords returns the number of words needed to hold n integers of the given bit width.
+func packedWords(n uint64, width uint) uint64 {
+	return (n*uint64(width) + 63) / 64
+}
+
+// get returns the integer at position i.
+func (p packedInts) get(i uint64) uint64 {
+	if p.width == 0 {
+		return 0
+	}
+	pos := i * uint64(p.width)
+	x, y := pos/64, pos%64
+	v := p.data[x] >> y
+	if y+uint64(p.width) > 64 {
+		v |= p.data[x+1] << (64 - y)
+	}
+	if p.width == 64 {
+		return v
+	}
+	return v & (1<<p.width - 1)
+}
+
+// set sets the integer at position i to v, which must fit in the bit width.
+// The integer at position i must be zero.
+func (p packedInts) set(i, v uint64) {
+	if p.width == 0 {
+		return
+	}
+	pos := i * uint64(p.width)
+	x, y := pos/64, pos%64
+	p.data[x] |= v << y
+	if y+uint64(p.width) > 64 {
+		p.data[x+1] |= v >> (64 - y)
+	}
+}
+
+// selectSample is the number of one bits between the samples used by select1.
+const selectSample = 256
+
+// eliasFano is the Elias-Fano encoding of a non-decreasing sequence of integers.
+// The smallest integer is stored as a base, which is subtracted from all integers.
+// Each integer is then split into its low bits, stored in a packed array, and its
+// high bits, stored in unary as gaps in a bit vector: the i-th integer sets the bit
+// at position high+i. With n integers spanning a range of size u, the encoding uses
+// at most 2 + log2(u/n) bits per integer.
+type eliasFano struct {
+	n       uint64
+	base    uint64
+	low     packedInts
+	high    bitVector
+	samples []uint64 // position of every selectSample-th one bit in high
+}
+
+// newEliasFano returns the Elias-Fano encoding of the sorted values.
+func newEliasFano(sorted []uint64) eliasFano {
+	n := uint64(len(sorted))
+	if n == 0 {
+		return eliasFano{}
+	}
+	base := sorted[0]
+	span := sorted[n-1] - base
+	var lowBits uint
+	if span/n > 0 {
+		lowBits = uint(bits.Len64(span/n) - 1)
+	}
+	ef := eliasFano{
+		n:    n,
+		base: base,
+		low:  newPackedInts(n, lowBits),
+		high: make(bitVector, ((span>>lowBits)+n+63)/64),
+	}
+	for i, v := range sorted {
+		v -= base
+		ef.low.set(uint64(i), v&(1<<lowBits-1))
+		ef.high.set(v>>lowBits + uint64(i))
+	}
+	ef.computeSamples()
+	return ef
+}
+
+// computeSamples computes the positions of every selectSample-th one bit in high.
+func (ef *eliasFano) computeSamples() {
+	ef.samples = make([]uint64, 0, ef.n/selectSample+1)
+	var ones uint64
+	for x, w := range ef.high {
+		for w != 0 {
+			if ones%selectSample == 0 {
+				ef.samples = append(ef.samples, uint64(x*64+bits.TrailingZeros64(w)))
+			}
+			ones++
+			w &= w - 1 // clear the lowest one bit
+		}
+	}
+}
+
+// get returns the integer at position i.
+func (ef *eliasFano) get(i uint64) uint64 {
+	high := ef.select1(i) - i
+	return ef.base + (high<<ef.low.width | ef.low.get(i))
+}
+
+// select1 returns the position of the i-th one bit (0-based) in high.
+func (ef *eliasFano) select1(i uint64) uint64 {
+	pos := ef.samples[i/selectSample]
+	rem := i % selectSample
+	x := pos / 64
+	// ignore the bits before the sampled one bit in its word
+	w := ef.high[x] &^ (1<<(pos%64) - 1)
+	for {
+		ones := uint64(bits.OnesCount64(w))
+		if rem < ones {
+			break
+		}
+		rem -= ones
+		x++
+		w = ef.high[x]
+	}
+	for ; rem > 0; rem-- {
+		w &= w - 1 // clear the lowest one bit
+	}
+	return x*64 + uint64(bits.TrailingZeros64(w))
+}
+
+// sizeBits returns the number of bits used by the encoding, excluding the samples,
+// which are recomputed when the encoding is decoded.
+func (ef *eliasFano) sizeBits() uint64 {
+	return 64 * uint64(1+len(ef.low.data)+len(ef.high))
+}
+
+// eliasFanoHeaderLength is the length of the encoding's header: the number of low bits,
+// the base and the number of words in high.
+const eliasFanoHeaderLength = 1 + 2*uint64bytes
+
+// marshaledLength returns the number of bytes needed to marshal the encoding.
+func (ef *eliasFano) marshaledLength() int {
+	return eliasFanoHeaderLength + uint64bytes*(len(ef.low.data)+len(ef.high))
+}
+
+// appendBinary appends the encoding to buf: the number of low bits, the base, the number
+// of words in high, the low bits and the high bits. The number of integers is not included.
+func (ef *eliasFano) appendBinary(buf []byte) []byte {
+	buf = append(buf, uint8(ef.low.width))
+	buf = binary.LittleEndian.AppendUint64(buf, ef.base)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(ef.high)))
+	for _, w := range ef.low.data {
+		buf = binary.LittleEndian.AppendUint64(buf, w)
+	}
+	for _, w := range ef.high {
+		buf = binary.LittleEndian.AppendUint64(buf, w)
+	}
+	return buf
+}
+
+// unmarshalEliasFano decodes an encoding of n integers written by appendBinary from
+// the start of buf, and returns the remaining data.
+func unmarshalEliasFano(buf []byte, n uint64) (eliasFano, []byte, error) {
+	if len(buf) < eliasFanoHeaderLength {
+		return eliasFano{}, nil, errors.New("insufficient data for Elias-Fano header")
+	}
+	lowBits := uint(buf[0])
+	base := binary.LittleEndian.Uint64(buf[1:])
+	highWords := binary.LittleEndian.Uint64(buf[1+uint64bytes:])
+	buf = buf[eliasFanoHeaderLength:]
+	if lowBits > 63 {
+		return eliasFano{}, nil, errors.New("invalid number of Elias-Fano low bits")
+	}
+	lowWords := packedWords(n, lowBits)
+	if highWords > uint64(len(buf))/uint64bytes || lowWords > uint64(len(buf))/uint64bytes-highWords {
+		return eliasFano{}, nil, errors.New("insufficient data for Elias-Fano encoding")
+	}
+	ef := eliasFano{n: n, base: base, low: newPackedInts(n, lowBits), high: make(bitVector, highWords)}
+	for i := range ef.low.data {
+		ef.low.data[i] = binary.LittleEndian.Uint64(buf)
+		buf = buf[uint64bytes:]
+	}
+	for i := range ef.high {
+		ef.high[i] = binary.LittleEndian.Uint64(buf)
+		buf = buf[uint64bytes:]
+	}
+	if ef.high.onesCount() != n {
+		return eliasFano{}, nil, errors.New("Elias-Fano encoding does not match number of keys")
+	}
+	ef.computeSamples()
+	return ef, buf, nil
+}
@@ -0,0 +1,116 @@
+package bbhash
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/relab/bbhash/internal/test"
+)
+
+func TestPackedInts(t *testing.T) {
+	const n = 1000
+	r := rand.New(rand.NewSource(99))
+	for _, width := range []uint{0, 1, 3, 7, 13, 32, 33, 63, 64} {
+		t.Run(test.Name("", []string{"width"}, width), func(t *testing.T) {
+			values := make([]uint64, n)
+			p := newPackedInts(n, width)
+			for i := range values {
+				if width > 0 {
+					values[i] = r.Uint64() >> (64 - width)
+				}
+				p.set(uint64(i), values[i])
+			}
+			for i, want := range values {
+				if got := p.get(uint64(i)); got != want {
+					t.Fatalf("get(%d) = %d, expected %d", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEliasFano(t *testing.T) {
+	r := rand.New(rand.NewSource(99))
+	random := make([]uint64, 5000)
+	for i := range random {
+		random[i] = r.Uint64()
+	}
+	clustered := make([]uint64, 5000)
+	for i := range clustered {
+		clustered[i] = 1<<40 + uint64(i)*3 + uint64(r.Intn(3))
+	}
+	tests := []struct {
+		name   string
+		values []uint64
+	}{
+		{name: "empty", values: nil},
+		{name: "zero", values: []uint64{0}},
+		{name: "max", values: []uint64{0, 1<<64 - 1}},
+		{name: "duplicates", values: []uint64{1, 1, 1, 5, 5, 9}},
+		{name: "dense", values: []uint64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{name: "random", values: random},
+		{name: "clustered", values: clustered},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorted := slices.Sorted(slices.Values(tt.values))
+			ef := newEliasFano(sorted)
+			checkEliasFano(t, &ef, sorted)
+			if tt.name == "clustered" {
+				// the values span about 3 per value, so about 2 + log2(3) bits per value
+				if bpv := float64(ef.sizeBits()) / float64(len(sorted)); bpv > 4 {
+					t.Errorf("bits per value = %.1f, expected at most 4", bpv)
+				}
+			}
+
+			buf := ef.appendBinary(nil)
+			if len(buf) != ef.marshaledLength() {
+				t.Errorf("len(appendBinary()) = %d, expected %d", len(buf), ef.marshaledLength())
+			}
+			decoded, rest, err := unmarshalEliasFano(append(buf, 0xff), uint64(len(sorted)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rest) != 1 {
+				t.Errorf("unmarshalEliasFano left %d bytes, expected 1", len(rest))
+			}
+			checkEliasFano(t, &decoded, sorted)
+		})
+	}
+}
+
+func checkEliasFano(t *testing.T, ef *eliasFano, sorted []uint64) {
+	t.Helper()
+	for i, want := range sorted {
+		if got := ef.get(uint64(i)); got != want {
+			t.Fatalf("get(%d) = %d, expected %d", i, got, want)
+		}
+	}
+}
+
+func TestCompressedMapUnmarshalErrors(t *testing.T) {
+	keys := []uint64{10, 3, 7, 42, 5}
+	m := newCompressedMap(keys)
+	for index := uint64(1); index <= m.len(); index++ {
+		if got := m.key(index); got != keys[index-1] {
+			t.Errorf("key(%d) = %d, expected %d", index, got, keys[index-1])
+		}
+	}
+	buf := m.appendBinary(nil)
+	if _, err := unmarshalCompressedMap(buf, uint64(len(keys))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unmarshalCompressedMap(buf[:len(buf)-1], uint64(len(keys))); err == nil {
+		t.Error("unmarshalCompressedMap accepted truncated data")
+	}
+	if _, err := unmarshalCompressedMap(buf, uint64(len(keys))+1); err == nil {
+		t.Error("unmarshalCompressedMap accepted wrong number of keys")
+	}
+	// the last word holds the permutation of 3-bit positions; 7 is out of range
+	bad := slices.Clone(buf)
+	bad[len(bad)-uint64bytes] |= 0x07
+	if _, err := unmarshalCompressedMap(bad, uint64(len(keys))); err == nil {
+		t.Error("unmarshalCompressedMap accepted invalid permutation")
+	}
+}
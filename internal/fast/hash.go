@@ -2,6 +2,13 @@ package fast
 
 const m uint64 = 0x880355f21e6d1965
 
+// Constants used by LevelHash and KeyHash; exported for code generators
+// that must reproduce the hash functions.
+const (
+	M             = m
+	MixMultiplier = 0x2127599bf4325c37
+)
+
 // Hash returns the hash of the current level and key.
 func Hash(level, key uint64) uint64 {
 	return KeyHash(LevelHash(level), key)
@@ -24,7 +31,7 @@ func KeyHash(levelHash, key uint64) uint64 {
 // mix is a compression function for fast hashing.
 func mix(h uint64) uint64 {
 	h ^= h >> 23
-	h *= 0x2127599bf4325c37
+	h *= MixMultiplier
 	h ^= h >> 47
 	return h
 }
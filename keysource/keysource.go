@@ -0,0 +1,249 @@
+// Package keysource reads keys for bbhash from common file formats.
+//
+// Each reader returns a Source, whose All method returns an iter.Seq of the keys
+// that can be passed to code consuming sequences, and whose Err method reports
+// the first error encountered, if any. Reading stops at the first error.
+//
+//	src := keysource.Decimal(f)
+//	keys, err := src.Collect()
+//	bb, err := bbhash.New(keys)
+//
+// Lines returns the raw lines of a reader, which can be hashed with bbhash.Keys:
+//
+//	src := keysource.Lines(f)
+//	keys := bbhash.Keys(bbhash.FastHashFunc, src.All())
+//	if err := src.Err(); err != nil { ... }
+package keysource
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxLineLength is the maximum length of a line.
+const maxLineLength = 1 << 20
+
+// errConsumed is reported when a Source is read more than once.
+var errConsumed = errors.New("keysource: source already read")
+
+// Source is a sequence of values read from an io.Reader.
+// A Source can only be read once.
+type Source[T any] struct {
+	read     func(yield func(T) bool) error
+	consumed bool
+	err      error
+}
+
+// newSource returns a source that reads values with read.
+func newSource[T any](read func(yield func(T) bool) error) *Source[T] {
+	return &Source[T]{read: read}
+}
+
+// All returns an iterator over the values of the source. The iteration stops at
+// the first error, which is reported by Err. Stopping the iteration early is not
+// an error, but the remaining values cannot be read.
+func (s *Source[T]) All() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		if s.consumed {
+			s.err = errConsumed
+			return
+		}
+		s.consumed = true
+		s.err = s.read(yield)
+	}
+}
+
+// Err returns the first error encountered while reading the source, if any.
+func (s *Source[T]) Err() error {
+	return s.err
+}
+
+// Collect reads all values of the source into a slice.
+func (s *Source[T]) Collect() ([]T, error) {
+	values := slices.Collect(s.All())
+	return values, s.Err()
+}
+
+// Parse returns the keys of r, one per line, parsed with parse. Surrounding
+// whitespace is ignored, as are empty lines and lines starting with #.
+// Errors include the line number.
+func Parse(r io.Reader, parse func(line string) (uint64, error)) *Source[uint64] {
+	return newSource(func(yield func(uint64) bool) error {
+		sc := newScanner(r)
+		for lineNum := 1; sc.Scan(); lineNum++ {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, err := parse(line)
+			if err != nil {
+				return fmt.Errorf("keysource: line %d: %w", lineNum, err)
+			}
+			if !yield(key) {
+				return nil
+			}
+		}
+		return wrap(sc.Err())
+	})
+}
+
+// Decimal returns the keys of r, one decimal unsigned integer per line.
+// Surrounding whitespace is ignored, as are empty lines and lines starting with #.
+func Decimal(r io.Reader) *Source[uint64] {
+	return Parse(r, func(s string) (uint64, error) {
+		return strconv.ParseUint(s, 10, 64)
+	})
+}
+
+// Hex returns the keys of r, one hexadecimal unsigned integer per line, with or
+// without a 0x prefix. Surrounding whitespace is ignored, as are empty lines and
+// lines starting with #.
+func Hex(r io.Reader) *Source[uint64] {
+	return Parse(r, func(s string) (uint64, error) {
+		s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+		return strconv.ParseUint(s, 16, 64)
+	})
+}
+
+// Binary returns the keys of r, stored as an array of raw little-endian uint64 values.
+// Trailing bytes that do not form a complete key are reported as an error.
+func Binary(r io.Reader) *Source[uint64] {
+	return newSource(func(yield func(uint64) bool) error {
+		br := bufio.NewReader(r)
+		buf := make([]byte, 8)
+		for i := 0; ; i++ {
+			n, err := io.ReadFull(br, buf)
+			switch {
+			case err == io.EOF:
+				return nil
+			case err == io.ErrUnexpectedEOF:
+				return fmt.Errorf("keysource: %d trailing bytes after key %d", n, i)
+			case err != nil:
+				return wrap(err)
+			}
+			if !yield(binary.LittleEndian.Uint64(buf)) {
+				return nil
+			}
+		}
+	})
+}
+
+// CSV returns the keys in the given zero-based column of the CSV records in r,
+// as decimal unsigned integers. If header is true, the first record is skipped.
+// Errors include the line number.
+func CSV(r io.Reader, column int, header bool) *Source[uint64] {
+	return newSource(func(yield func(uint64) bool) error {
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		cr.ReuseRecord = true
+		if header {
+			if _, err := cr.Read(); err != nil {
+				return wrap(ignoreEOF(err))
+			}
+		}
+		return readCSV(cr, column, yield)
+	})
+}
+
+// CSVHeader returns the keys in the named column of the CSV records in r,
+// as decimal unsigned integers. The first record is the header with the column names.
+// Errors include the line number.
+func CSVHeader(r io.Reader, name string) *Source[uint64] {
+	return newSource(func(yield func(uint64) bool) error {
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		cr.ReuseRecord = true
+		header, err := cr.Read()
+		if err != nil {
+			return wrap(ignoreEOF(err))
+		}
+		column := slices.Index(header, name)
+		if column < 0 {
+			return fmt.Errorf("keysource: no column named %q", name)
+		}
+		return readCSV(cr, column, yield)
+	})
+}
+
+// readCSV yields the keys in the given column of the remaining records of cr.
+func readCSV(cr *csv.Reader, column int, yield func(uint64) bool) error {
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return wrap(err)
+		}
+		line, _ := cr.FieldPos(0)
+		if column < 0 || column >= len(record) {
+			return fmt.Errorf("keysource: line %d: no column %d", line, column)
+		}
+		key, err := strconv.ParseUint(strings.TrimSpace(record[column]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("keysource: line %d: %w", line, err)
+		}
+		if !yield(key) {
+			return nil
+		}
+	}
+}
+
+// HashedLines returns the hash of each line of r as a key; see bbhash.FastHashFunc
+// and bbhash.SHA256HashFunc. Each line is hashed as is, without the line ending.
+func HashedLines(r io.Reader, hash func([]byte) uint64) *Source[uint64] {
+	lines := Lines(r)
+	return newSource(func(yield func(uint64) bool) error {
+		for line := range lines.All() {
+			if !yield(hash(line)) {
+				return nil
+			}
+		}
+		return lines.Err()
+	})
+}
+
+// Lines returns the lines of r, without line endings (\n or \r\n).
+// The yielded slices are only valid until the next line is yielded.
+func Lines(r io.Reader) *Source[[]byte] {
+	return newSource(func(yield func([]byte) bool) error {
+		sc := newScanner(r)
+		for sc.Scan() {
+			if !yield(sc.Bytes()) {
+				return nil
+			}
+		}
+		return wrap(sc.Err())
+	})
+}
+
+// newScanner returns a line scanner for r that accepts lines up to maxLineLength.
+func newScanner(r io.Reader) *bufio.Scanner {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	return sc
+}
+
+// wrap prefixes err with the package name, if non-nil.
+func wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("keysource: %w", err)
+}
+
+// ignoreEOF returns nil if err is io.EOF.
+func ignoreEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
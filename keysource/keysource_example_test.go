@@ -0,0 +1,24 @@
+package keysource_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/relab/bbhash"
+	"github.com/relab/bbhash/keysource"
+)
+
+func ExampleCSVHeader() {
+	input := "name,id\nalice,17\nbob,42\ncarol,99\n"
+	keys, err := keysource.CSVHeader(strings.NewReader(input), "id").Collect()
+	if err != nil {
+		panic(err)
+	}
+	bb, err := bbhash.New(keys)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(keys, bb.Find(42) != 0)
+	// Output:
+	// [17 42 99] true
+}
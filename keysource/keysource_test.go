@@ -0,0 +1,143 @@
+package keysource_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/relab/bbhash"
+	"github.com/relab/bbhash/keysource"
+)
+
+func TestSources(t *testing.T) {
+	le := func(keys ...uint64) string {
+		var buf []byte
+		for _, k := range keys {
+			buf = binary.LittleEndian.AppendUint64(buf, k)
+		}
+		return string(buf)
+	}
+	hash := func(s string) uint64 { return bbhash.FastHashFunc([]byte(s)) }
+	csvColumn := func(column int, header bool) func(io.Reader) *keysource.Source[uint64] {
+		return func(r io.Reader) *keysource.Source[uint64] { return keysource.CSV(r, column, header) }
+	}
+	csvHeader := func(name string) func(io.Reader) *keysource.Source[uint64] {
+		return func(r io.Reader) *keysource.Source[uint64] { return keysource.CSVHeader(r, name) }
+	}
+	hashedLines := func(r io.Reader) *keysource.Source[uint64] { return keysource.HashedLines(r, bbhash.FastHashFunc) }
+
+	tests := []struct {
+		name    string
+		source  func(io.Reader) *keysource.Source[uint64]
+		input   string
+		want    []uint64
+		wantErr string
+	}{
+		{name: "Decimal", source: keysource.Decimal, input: "1\n 2 \n\n# comment\n18446744073709551615", want: []uint64{1, 2, 1<<64 - 1}},
+		{name: "Decimal/CRLF", source: keysource.Decimal, input: "1\r\n2\r\n", want: []uint64{1, 2}},
+		{name: "Decimal/Empty", source: keysource.Decimal, input: ""},
+		{name: "Decimal/Invalid", source: keysource.Decimal, input: "1\n0x2\n", want: []uint64{1}, wantErr: "line 2"},
+		{name: "Decimal/Overflow", source: keysource.Decimal, input: "18446744073709551616\n", wantErr: "line 1"},
+		{name: "Hex", source: keysource.Hex, input: "ff\n0x10\n0XAB\n", want: []uint64{0xff, 0x10, 0xab}},
+		{name: "Hex/Invalid", source: keysource.Hex, input: "ff\nxyz\n", want: []uint64{0xff}, wantErr: "line 2"},
+		{name: "Binary", source: keysource.Binary, input: le(0, 1, 1<<63), want: []uint64{0, 1, 1 << 63}},
+		{name: "Binary/Trailing", source: keysource.Binary, input: le(7) + "abc", want: []uint64{7}, wantErr: "3 trailing bytes after key 1"},
+		{name: "CSV", source: csvColumn(1, false), input: "a,1\nb, 2\n\"c,d\",3\n", want: []uint64{1, 2, 3}},
+		{name: "CSV/Header", source: csvColumn(0, true), input: "id,name\n5,a\n6,b\n", want: []uint64{5, 6}},
+		{name: "CSV/MissingColumn", source: csvColumn(1, false), input: "a,1\nb\n", want: []uint64{1}, wantErr: "line 2: no column 1"},
+		{name: "CSV/Invalid", source: csvColumn(0, false), input: "1\nx\n", want: []uint64{1}, wantErr: "line 2"},
+		{name: "CSVHeader", source: csvHeader("id"), input: "name,id\na,5\nb,6\n", want: []uint64{5, 6}},
+		{name: "CSVHeader/Unknown", source: csvHeader("key"), input: "name,id\na,5\n", wantErr: `no column named "key"`},
+		{name: "CSVHeader/Empty", source: csvHeader("id"), input: ""},
+		{name: "HashedLines", source: hashedLines, input: "foo\r\n\nbar", want: []uint64{hash("foo"), hash(""), hash("bar")}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			readers := map[string]io.Reader{
+				"Reader":        strings.NewReader(test.input),
+				"OneByteReader": iotest.OneByteReader(strings.NewReader(test.input)),
+			}
+			for name, r := range readers {
+				got, err := test.source(r).Collect()
+				if diff := cmp.Diff(test.want, got); diff != "" {
+					t.Errorf("%s: Collect() mismatch (-want +got):\n%s", name, diff)
+				}
+				checkErr(t, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func checkErr(t *testing.T, err error, wantErr string) {
+	t.Helper()
+	switch {
+	case wantErr == "" && err != nil:
+		t.Errorf("Err() = %v, want nil", err)
+	case wantErr != "" && (err == nil || !strings.Contains(err.Error(), wantErr)):
+		t.Errorf("Err() = %v, want error containing %q", err, wantErr)
+	}
+}
+
+func TestSourceReadError(t *testing.T) {
+	errRead := errors.New("read failed")
+	r := io.MultiReader(strings.NewReader("1\n2\n"), iotest.ErrReader(errRead))
+	src := keysource.Decimal(r)
+	got := slices.Collect(src.All())
+	if diff := cmp.Diff([]uint64{1, 2}, got); diff != "" {
+		t.Errorf("All() mismatch (-want +got):\n%s", diff)
+	}
+	if !errors.Is(src.Err(), errRead) {
+		t.Errorf("Err() = %v, want %v", src.Err(), errRead)
+	}
+}
+
+func TestSourceStopEarly(t *testing.T) {
+	src := keysource.Decimal(strings.NewReader("1\n2\n3\n"))
+	for key := range src.All() {
+		if key == 2 {
+			break
+		}
+	}
+	if src.Err() != nil {
+		t.Errorf("Err() = %v, want nil", src.Err())
+	}
+	// A source can only be read once.
+	if got := slices.Collect(src.All()); len(got) != 0 {
+		t.Errorf("second All() = %v, want no keys", got)
+	}
+	if src.Err() == nil {
+		t.Error("Err() = nil after second All(), want error")
+	}
+}
+
+func TestLinesKeys(t *testing.T) {
+	input := "alpha\nbeta\ngamma\n"
+	src := keysource.Lines(strings.NewReader(input))
+	got := bbhash.Keys(bbhash.FastHashFunc, src.All())
+	if err := src.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := keysource.HashedLines(strings.NewReader(input), bbhash.FastHashFunc)
+	wantKeys, err := want.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(wantKeys, got); diff != "" {
+		t.Errorf("Keys() mismatch (-want +got):\n%s", diff)
+	}
+
+	bb, err := bbhash.New(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range got {
+		if bb.Find(key) == 0 {
+			t.Errorf("Find(%#x) = 0, want non-zero", key)
+		}
+	}
+}
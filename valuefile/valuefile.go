@@ -0,0 +1,399 @@
+// Package valuefile writes fixed-width values in the index order of a BBHash2.
+//
+// A common use of a minimal perfect hash function is to store the value of each
+// key in an array at position Find(key)-1. Write builds such an array as a file
+// from a stream of (key, value) records in arbitrary order, without holding all
+// the values in memory. The output is divided into buckets of consecutive indices
+// that fit in the memory budget. The records are first distributed to temporary
+// bucket files, and each bucket is then filled in memory and written in order.
+// At most 256 temporary files are written at once; with more buckets, the records
+// are distributed in several passes, to files holding groups of buckets first.
+// If the whole output fits in the memory budget, no temporary files are used.
+//
+//	src := valuefile.Records(f, 16)
+//	stats, err := valuefile.Write(out, bb, 16, src.All(), valuefile.MemoryBudget(1<<30))
+//	if err == nil {
+//		err = src.Err()
+//	}
+//
+// The value of the key with index i (as returned by Find) is then at offset
+// (i-1)*width in the output.
+package valuefile
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+
+	"github.com/relab/bbhash"
+)
+
+const (
+	// defaultMemoryBudget is the default memory budget for the values of a bucket.
+	defaultMemoryBudget = 256 << 20
+
+	// maxOpenFiles is the maximum number of temporary files written at once.
+	maxOpenFiles = 256
+
+	// offsetBytes is the size of the bucket offset stored with each value in the bucket files.
+	offsetBytes = 8
+
+	// keyBytes is the size of the key at the start of each record read by RecordReader.
+	keyBytes = 8
+)
+
+// Record is a key and its value.
+type Record struct {
+	Key   uint64
+	Value []byte
+}
+
+// Options are options for Write.
+type Options func(*options)
+
+type options struct {
+	memoryBudget int
+	tempDir      string
+}
+
+func newOptions(opts ...Options) *options {
+	o := &options{
+		memoryBudget: defaultMemoryBudget,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// MemoryBudget sets the number of bytes used to hold the values of a bucket.
+// The default is 256 MiB. Write also uses a small buffer for each temporary file
+// written at once and a bitmap of the indices of a bucket.
+func MemoryBudget(bytes int) Options {
+	return func(o *options) {
+		o.memoryBudget = bytes
+	}
+}
+
+// TempDir sets the directory of the temporary bucket files.
+// The default is the directory returned by os.TempDir.
+func TempDir(dir string) Options {
+	return func(o *options) {
+		o.tempDir = dir
+	}
+}
+
+// Stats describes the output of Write.
+type Stats struct {
+	// Records is the number of records written.
+	Records uint64
+	// Missing is the number of indices without a record, whose values are zero.
+	Missing uint64
+	// Buckets is the number of buckets; 1 means no temporary files were used.
+	Buckets int
+}
+
+// Write writes the values of the records to w in the index order of bb, as bb.Len()
+// values of width bytes each. Indices without a record are filled with zeros and
+// counted in Stats.Missing. The values of the records must be width bytes long and
+// may be reused by the iterator after each record.
+//
+// Write returns an error if a key is not in bb, or if two records map to the same
+// index. If bb has a reverse map, keys not in bb are always detected; otherwise,
+// they are only detected if Find returns 0 or if their index is taken by another record.
+func Write(w io.Writer, bb *bbhash.BBHash2, width int, records iter.Seq[Record], opts ...Options) (Stats, error) {
+	o := newOptions(opts...)
+	if width < 1 {
+		return Stats{}, fmt.Errorf("valuefile.Write: invalid width %d", width)
+	}
+	if o.memoryBudget < width {
+		return Stats{}, fmt.Errorf("valuefile.Write: memory budget %d smaller than width %d", o.memoryBudget, width)
+	}
+	n := uint64(bb.Len())
+	perBucket := max(min(uint64(o.memoryBudget/width), n), 1)
+	buckets := (n + perBucket - 1) / perBucket
+	v := &writer{bb: bb, width: width, n: n, perBucket: perBucket, exact: bb.HasReverseMap(), tempDir: o.tempDir}
+	if buckets <= 1 {
+		return v.writeInMemory(w, records)
+	}
+	return v.writeBuckets(w, records, int(buckets))
+}
+
+// writer holds the parameters of a Write call.
+type writer struct {
+	bb        *bbhash.BBHash2
+	width     int
+	n         uint64
+	perBucket uint64
+	exact     bool // use FindExact to detect keys not in bb
+	tempDir   string
+	temp      []string // names of the temporary files created
+	stats     Stats
+}
+
+// index returns the 0-based index of the key in bb.
+func (v *writer) index(r Record) (uint64, error) {
+	if len(r.Value) != v.width {
+		return 0, fmt.Errorf("valuefile.Write: key %d: value length %d, expected %d", r.Key, len(r.Value), v.width)
+	}
+	var index uint64
+	var ok bool
+	if v.exact {
+		index, ok = v.bb.FindExact(r.Key)
+	} else {
+		index, ok = v.bb.Lookup(r.Key)
+	}
+	if !ok {
+		return 0, fmt.Errorf("valuefile.Write: key %d not found", r.Key)
+	}
+	return index - 1, nil
+}
+
+// writeInMemory fills all the values in memory and writes them to w.
+func (v *writer) writeInMemory(w io.Writer, records iter.Seq[Record]) (Stats, error) {
+	b := v.newBucket(v.n)
+	for r := range records {
+		index, err := v.index(r)
+		if err != nil {
+			return v.stats, err
+		}
+		if err := b.put(index, r.Value); err != nil {
+			return v.stats, fmt.Errorf("%w (key %d, index %d)", err, r.Key, index+1)
+		}
+		v.stats.Records++
+	}
+	v.stats.Buckets = 1
+	v.stats.Missing = v.n - v.stats.Records
+	_, err := w.Write(b.values)
+	return v.stats, err
+}
+
+// writeBuckets distributes the records to temporary bucket files, and then fills
+// each bucket in memory and writes it to w.
+func (v *writer) writeBuckets(w io.Writer, records iter.Seq[Record], buckets int) (Stats, error) {
+	defer func() {
+		for _, name := range v.temp {
+			os.Remove(name)
+		}
+	}()
+
+	// Pass 1: append the offset and value of each record to the file of its group of buckets.
+	var indexErr error
+	src := func(yield func(uint64, []byte) bool) {
+		for r := range records {
+			var index uint64
+			if index, indexErr = v.index(r); indexErr != nil || !yield(index, r.Value) {
+				return
+			}
+			v.stats.Records++
+		}
+	}
+	groups, err := v.distribute(src, 0, buckets)
+	if err == nil {
+		err = indexErr
+	}
+	if err != nil {
+		return v.stats, err
+	}
+
+	// Pass 2: fill each bucket from the file of its group and write it to w.
+	for _, g := range groups {
+		if err := v.fill(w, g); err != nil {
+			return v.stats, err
+		}
+	}
+	v.stats.Buckets = buckets
+	v.stats.Missing = v.n - v.stats.Records
+	return v.stats, nil
+}
+
+// group is a temporary file holding the records of count consecutive buckets
+// starting at bucket first. The offset of each record is relative to the group.
+type group struct {
+	name  string
+	first int
+	count int
+}
+
+// distribute appends the records of src, given as offsets relative to bucket first,
+// to the files of at most maxOpenFiles groups of the count buckets starting at first.
+func (v *writer) distribute(src iter.Seq2[uint64, []byte], first, count int) ([]group, error) {
+	perGroup := (count + maxOpenFiles - 1) / maxOpenFiles
+	groups := make([]group, (count+perGroup-1)/perGroup)
+	files := make([]*os.File, len(groups))
+	writers := make([]*bufio.Writer, len(groups))
+	defer func() {
+		for _, f := range files {
+			if f != nil {
+				f.Close()
+			}
+		}
+	}()
+	for i := range groups {
+		f, err := os.CreateTemp(v.tempDir, "valuefile-*.bucket")
+		if err != nil {
+			return nil, err
+		}
+		v.temp = append(v.temp, f.Name())
+		files[i] = f
+		writers[i] = bufio.NewWriter(f)
+		groups[i] = group{name: f.Name(), first: first + i*perGroup, count: min(perGroup, count-i*perGroup)}
+	}
+
+	groupSize := uint64(perGroup) * v.perBucket
+	var offset [offsetBytes]byte
+	for index, value := range src {
+		bw := writers[index/groupSize]
+		binary.LittleEndian.PutUint64(offset[:], index%groupSize)
+		bw.Write(offset[:])
+		if _, err := bw.Write(value); err != nil {
+			return nil, err
+		}
+	}
+	for i, bw := range writers {
+		if err := bw.Flush(); err != nil {
+			return nil, err
+		}
+		err := files[i].Close()
+		files[i] = nil
+		if err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+// fill writes the values of the buckets of g to w. If g holds more than one bucket,
+// its records are first distributed to smaller groups, which are filled in order.
+func (v *writer) fill(w io.Writer, g group) error {
+	f, err := os.Open(g.name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var readErr error
+	src := func(yield func(uint64, []byte) bool) {
+		br := bufio.NewReader(f)
+		record := make([]byte, offsetBytes+v.width)
+		for {
+			if _, err := io.ReadFull(br, record); err != nil {
+				if err != io.EOF {
+					readErr = err
+				}
+				return
+			}
+			if !yield(binary.LittleEndian.Uint64(record), record[offsetBytes:]) {
+				return
+			}
+		}
+	}
+
+	if g.count > 1 {
+		groups, err := v.distribute(src, g.first, g.count)
+		if err == nil {
+			err = readErr
+		}
+		if err != nil {
+			return err
+		}
+		// The records are now in the smaller groups; free the space of this one.
+		f.Close()
+		os.Remove(g.name)
+		for _, g := range groups {
+			if err := v.fill(w, g); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	start := uint64(g.first) * v.perBucket
+	b := v.newBucket(min(v.perBucket, v.n-start))
+	for offset, value := range src {
+		if err := b.put(offset, value); err != nil {
+			return fmt.Errorf("%w (index %d)", err, start+offset+1)
+		}
+	}
+	if readErr != nil {
+		return readErr
+	}
+	f.Close()
+	os.Remove(g.name)
+	_, err = w.Write(b.values)
+	return err
+}
+
+// bucket holds the values of a range of consecutive indices.
+type bucket struct {
+	width  int
+	values []byte
+	filled []uint64 // bitmap of the offsets with a value
+}
+
+// newBucket returns a bucket for size values.
+func (v *writer) newBucket(size uint64) *bucket {
+	return &bucket{
+		width:  v.width,
+		values: make([]byte, size*uint64(v.width)),
+		filled: make([]uint64, (size+63)/64),
+	}
+}
+
+// errDuplicate is returned when two records map to the same index.
+var errDuplicate = errors.New("valuefile.Write: duplicate key or key not found")
+
+// put stores the value at the given offset in the bucket.
+func (b *bucket) put(offset uint64, value []byte) error {
+	x, y := offset/64, offset%64
+	if b.filled[x]&(1<<y) != 0 {
+		return errDuplicate
+	}
+	b.filled[x] |= 1 << y
+	copy(b.values[offset*uint64(b.width):], value)
+	return nil
+}
+
+// RecordReader reads records of a fixed width from an io.Reader. Each record is a key,
+// as a little-endian uint64, followed by a value of width bytes.
+type RecordReader struct {
+	r     io.Reader
+	width int
+	err   error
+}
+
+// Records returns a reader of the records in r, whose values are width bytes long.
+func Records(r io.Reader, width int) *RecordReader {
+	return &RecordReader{r: r, width: width}
+}
+
+// All returns an iterator over the records. The value of each record is only valid
+// until the next record is read. The iteration stops at the first error, which is
+// reported by Err.
+func (rr *RecordReader) All() iter.Seq[Record] {
+	return func(yield func(Record) bool) {
+		br := bufio.NewReader(rr.r)
+		buf := make([]byte, keyBytes+rr.width)
+		for n := 0; ; n++ {
+			if _, err := io.ReadFull(br, buf); err != nil {
+				if err == io.ErrUnexpectedEOF {
+					rr.err = fmt.Errorf("valuefile: trailing bytes after record %d", n)
+				} else if err != io.EOF {
+					rr.err = err
+				}
+				return
+			}
+			if !yield(Record{Key: binary.LittleEndian.Uint64(buf), Value: buf[keyBytes:]}) {
+				return
+			}
+		}
+	}
+}
+
+// Err returns the first error encountered while reading records, if any.
+func (rr *RecordReader) Err() error {
+	return rr.err
+}
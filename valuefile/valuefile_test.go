@@ -0,0 +1,152 @@
+package valuefile_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/relab/bbhash"
+	"github.com/relab/bbhash/valuefile"
+)
+
+const width = 12
+
+// value returns the value of the key: the key followed by its bitwise complement.
+func value(key uint64) []byte {
+	v := binary.LittleEndian.AppendUint64(nil, key)
+	return binary.LittleEndian.AppendUint32(v, ^uint32(key))
+}
+
+// recordFile returns the encoded records of the keys, in the given order.
+func recordFile(keys []uint64) []byte {
+	var buf []byte
+	for _, key := range keys {
+		buf = binary.LittleEndian.AppendUint64(buf, key)
+		buf = append(buf, value(key)...)
+	}
+	return buf
+}
+
+func generateKeys(size int, seed int64) []uint64 {
+	r := rand.New(rand.NewSource(seed))
+	keys := make([]uint64, size)
+	for i := range keys {
+		keys[i] = r.Uint64()
+	}
+	return keys
+}
+
+func TestWrite(t *testing.T) {
+	keys := generateKeys(10_000, 99)
+	shuffled := slices.Clone(keys)
+	rand.New(rand.NewSource(1)).Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+
+	tests := []struct {
+		name        string
+		opts        []bbhash.Options
+		records     []uint64
+		budget      int
+		wantBuckets int
+	}{
+		{name: "InMemory", records: shuffled, budget: 1 << 20, wantBuckets: 1},
+		{name: "Buckets", records: shuffled, budget: 1000 * width, wantBuckets: 10},
+		{name: "UnevenBuckets", records: shuffled, budget: 999, wantBuckets: 121},
+		{name: "ReverseMap", opts: []bbhash.Options{bbhash.Partitions(4), bbhash.WithReverseMap()}, records: shuffled, budget: 4096, wantBuckets: 30},
+		{name: "Missing", records: shuffled[:9_000], budget: 4096, wantBuckets: 30},
+		{name: "ManyBuckets", records: shuffled[:9_000], budget: 3 * width, wantBuckets: 3334}, // distributed in two passes
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bb, err := bbhash.New(keys, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			src := valuefile.Records(bytes.NewReader(recordFile(tt.records)), width)
+			var out bytes.Buffer
+			tempDir := t.TempDir()
+			stats, err := valuefile.Write(&out, bb, width, src.All(), valuefile.MemoryBudget(tt.budget), valuefile.TempDir(tempDir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entries, err := os.ReadDir(tempDir); err != nil || len(entries) != 0 {
+				t.Errorf("temporary directory has %d entries after Write (%v), want none", len(entries), err)
+			}
+			if err := src.Err(); err != nil {
+				t.Fatal(err)
+			}
+			want := valuefile.Stats{Records: uint64(len(tt.records)), Missing: uint64(len(keys) - len(tt.records)), Buckets: tt.wantBuckets}
+			if stats != want {
+				t.Errorf("Write() stats = %+v, want %+v", stats, want)
+			}
+			if out.Len() != len(keys)*width {
+				t.Fatalf("output length = %d, want %d", out.Len(), len(keys)*width)
+			}
+			present := make(map[uint64]bool)
+			for _, key := range tt.records {
+				present[key] = true
+			}
+			for _, key := range keys {
+				index := bb.Find(key)
+				got := out.Bytes()[(index-1)*width : index*width]
+				wantValue := make([]byte, width)
+				if present[key] {
+					wantValue = value(key)
+				}
+				if !bytes.Equal(got, wantValue) {
+					t.Fatalf("value at index %d = %x, want %x", index, got, wantValue)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	keys := generateKeys(5000, 99)
+	bb, err := bbhash.New(keys, bbhash.WithReverseMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown := generateKeys(1, 100)
+	tests := []struct {
+		name    string
+		records []valuefile.Record
+		width   int
+		budget  int
+		wantErr string
+	}{
+		{name: "InvalidWidth", width: 0, budget: 1 << 20, wantErr: "invalid width"},
+		{name: "SmallBudget", width: width, budget: width - 1, wantErr: "smaller than width"},
+		{name: "ValueLength", records: []valuefile.Record{{Key: keys[0], Value: []byte{1}}}, width: width, budget: 1 << 20, wantErr: "value length"},
+		{name: "UnknownKey", records: []valuefile.Record{{Key: unknown[0], Value: value(0)}}, width: width, budget: 1 << 20, wantErr: "not found"},
+		{name: "Duplicate", records: []valuefile.Record{{Key: keys[0], Value: value(0)}, {Key: keys[0], Value: value(0)}}, width: width, budget: 1 << 20, wantErr: "duplicate"},
+		{name: "DuplicateBuckets", records: []valuefile.Record{{Key: keys[0], Value: value(0)}, {Key: keys[0], Value: value(0)}}, width: width, budget: 100 * width, wantErr: "duplicate"},
+		{name: "DuplicateManyBuckets", records: []valuefile.Record{{Key: keys[0], Value: value(0)}, {Key: keys[0], Value: value(0)}}, width: width, budget: width, wantErr: "duplicate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := valuefile.Write(&bytes.Buffer{}, bb, tt.width, slices.Values(tt.records), valuefile.MemoryBudget(tt.budget), valuefile.TempDir(t.TempDir()))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Write() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRecordsTrailingBytes(t *testing.T) {
+	data := recordFile(generateKeys(3, 99))
+	src := valuefile.Records(bytes.NewReader(data[:len(data)-1]), width)
+	var n int
+	for range src.All() {
+		n++
+	}
+	if n != 2 {
+		t.Errorf("read %d records, want 2", n)
+	}
+	if err := src.Err(); err == nil || !strings.Contains(err.Error(), "trailing bytes") {
+		t.Errorf("Err() = %v, want trailing bytes error", err)
+	}
+}